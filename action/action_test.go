@@ -2,10 +2,14 @@ package action
 
 import (
 	"bytes"
+	"errors"
+	"io/ioutil"
 	"log"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/Juniper/go-netconf/netconf"
 	"github.com/damianoneill/nc-hammer/result"
 	"github.com/damianoneill/nc-hammer/suite"
 	"github.com/stretchr/testify/assert"
@@ -18,8 +22,8 @@ func Test_Execute(t *testing.T) {
 	myTests := []*suite.TestSuite{tsValid, tsInvalid}
 	start := time.Now()
 	resultChannel := make(chan result.NetconfResult)
-	handleResultsFinished := make(chan bool)
-	go result.HandleResults(resultChannel, handleResultsFinished, tsValid)
+	handleResultsFinished := make(chan string)
+	go result.HandleResults(resultChannel, handleResultsFinished, tsValid, nil)
 	for _, testsuite := range myTests {
 		for _, b := range testsuite.Blocks {
 			for _, a := range b.Actions {
@@ -39,3 +43,185 @@ func Test_Execute(t *testing.T) {
 		}
 	}
 }
+
+func Test_removeSession(t *testing.T) {
+	// sessions are only accessed holding the mutex, as they are by the clients of a run
+	gSessionsMutex.Lock()
+	gSessions[sessionKey(1, "10.0.0.1:830")] = nil
+	gSessions[sessionKey(2, "10.0.0.1:830")] = nil
+	gSessionsMutex.Unlock()
+
+	removeSession(1, "10.0.0.1:830", false)
+
+	gSessionsMutex.Lock()
+	defer gSessionsMutex.Unlock()
+	_, present := gSessions[sessionKey(1, "10.0.0.1:830")]
+	assert.False(t, present)
+	_, present = gSessions[sessionKey(2, "10.0.0.1:830")]
+	assert.True(t, present)
+	delete(gSessions, sessionKey(2, "10.0.0.1:830"))
+}
+
+// mockTransport replays canned messages, once exhausted Receive blocks until the transport is closed
+type mockTransport struct {
+	messages chan []byte
+	closed   chan bool
+}
+
+func (t *mockTransport) Send([]byte) error { return nil }
+func (t *mockTransport) Receive() ([]byte, error) {
+	select {
+	case m := <-t.messages:
+		return m, nil
+	case <-t.closed:
+		return nil, errors.New("WaitForFunc failed")
+	}
+}
+func (t *mockTransport) Close() error { close(t.closed); return nil }
+func (t *mockTransport) ReceiveHello() (*netconf.HelloMessage, error) {
+	return &netconf.HelloMessage{}, nil
+}
+func (t *mockTransport) SendHello(*netconf.HelloMessage) error { return nil }
+
+func Test_parseNotification(t *testing.T) {
+	when, err := parseNotification([]byte(`<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0"><eventTime>2018-07-18T19:56:01.5Z</eventTime><event/></notification>`))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2018, 7, 18, 19, 56, 1, 500000000, time.UTC), when.UTC())
+
+	_, err = parseNotification([]byte(`<rpc-reply><ok/></rpc-reply>`))
+	assert.Equal(t, errNotANotification, err)
+
+	_, err = parseNotification([]byte(`<notification><eventTime>yesterday</eventTime></notification>`))
+	assert.EqualError(t, err, "notification eventTime is not valid: yesterday")
+}
+
+func Test_listenForNotifications(t *testing.T) {
+	transport := &mockTransport{messages: make(chan []byte, 3), closed: make(chan bool)}
+	eventTime := time.Now().Add(-time.Second).Format(time.RFC3339Nano)
+	transport.messages <- []byte("<notification><eventTime>" + eventTime + "</eventTime></notification>")
+	transport.messages <- []byte("<rpc-reply><ok/></rpc-reply>")
+	transport.messages <- []byte("<notification><eventTime>" + eventTime + "</eventTime></notification>")
+	session := &netconf.Session{Transport: transport, SessionID: 7}
+
+	listen := 200
+	n := &suite.Netconf{Hostname: "10.0.0.1", Operation: stringAddr("create-subscription"), Stream: stringAddr("syslog"), Listen: &listen}
+	resultChannel := make(chan result.NetconfResult, 10)
+	listenForNotifications(time.Now(), 3, session, n, resultChannel)
+	session.Close()
+	close(resultChannel)
+
+	var results []result.NetconfResult
+	for r := range resultChannel {
+		results = append(results, r)
+	}
+	assert.Len(t, results, 2)
+	for _, r := range results {
+		assert.Equal(t, NotificationOperation, r.Operation)
+		assert.Equal(t, "syslog", r.Stream)
+		assert.Equal(t, 7, r.SessionID)
+		assert.Equal(t, 3, r.Client)
+		assert.True(t, r.Latency >= 1000)
+	}
+}
+
+func stringAddr(v string) *string { return &v }
+
+func Test_transportReceive(t *testing.T) {
+	server, client := net.Pipe()
+	go func() {
+		server.Write([]byte("<hello/>]]>]]>\n<rpc-reply><data>a > b</data></rpc-reply>]]>"))
+		server.Write([]byte("]]>"))
+		server.Close()
+	}()
+	transport := newTransport(client)
+
+	message, err := transport.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, "<hello/>", string(message))
+	message, err = transport.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, "<rpc-reply><data>a > b</data></rpc-reply>", string(message))
+	_, err = transport.Receive()
+	assert.True(t, isSessionClosed(err))
+}
+
+func Test_newSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		hello   string
+		chunked bool
+		err     bool
+	}{
+		{"hello", `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><session-id>7</session-id></hello>]]>]]>`, false, false},
+		{"base:1.1 hello", `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>` + base11Capability + `</capability></capabilities><session-id>7</session-id></hello>]]>]]>`, true, false},
+		{"malformed hello", `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><session-id>7</hello>]]>]]>`, false, true},
+		{"closed before the hello", `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">`, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			go func() {
+				server.Write([]byte(tt.hello))
+				if !bytes.HasSuffix([]byte(tt.hello), []byte(msgSeparator)) {
+					server.Close()
+					return
+				}
+				// discard the clients hello
+				ioutil.ReadAll(server)
+			}()
+			session, err := newSession(newTransport(client))
+			if tt.err {
+				assert.NotNil(t, err)
+				assert.Nil(t, session)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, 7, session.SessionID)
+			assert.Equal(t, tt.chunked, session.Transport.(*transport).chunked)
+		})
+	}
+}
+
+func Test_transportChunked(t *testing.T) {
+	server, client := net.Pipe()
+	go func() {
+		server.Write([]byte("<hello/>]]>]]>\n"))
+		server.Write([]byte("\n#10\n<rpc-reply\n#18\n><ok/></rpc-reply>\n##\n"))
+		server.Write([]byte("\n#0\n\n##\n"))
+		server.Close()
+	}()
+	transport := newTransport(client)
+
+	message, err := transport.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, "<hello/>", string(message))
+	transport.chunked = true
+	message, err = transport.Receive()
+	assert.Nil(t, err)
+	assert.Equal(t, "<rpc-reply><ok/></rpc-reply>", string(message))
+	_, err = transport.Receive()
+	assert.EqualError(t, err, "malformed chunk size")
+}
+
+func Test_transportSend(t *testing.T) {
+	for _, chunked := range []bool{false, true} {
+		server, client := net.Pipe()
+		transport := newTransport(client)
+		transport.chunked = chunked
+		// the message is framed in a buffer of its own rather than appended to the callers
+		data := make([]byte, 5, 64)
+		copy(data, "<rpc>")
+		go func() {
+			transport.Send(data)
+			client.Close()
+		}()
+		framed, _ := ioutil.ReadAll(server)
+		if chunked {
+			assert.Equal(t, "\n#5\n<rpc>\n##\n", string(framed))
+		} else {
+			assert.Equal(t, "<rpc>]]>]]>\n", string(framed))
+		}
+		assert.Equal(t, make([]byte, 59), data[5:64])
+	}
+}
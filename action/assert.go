@@ -0,0 +1,158 @@
+package action
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/damianoneill/nc-hammer/suite"
+)
+
+// AssertionFailed prefixes the error recorded when assertions of a reply fail, followed by the failure of each
+const AssertionFailed = "assertion failed"
+
+// checkAssertions returns a message for each assertion the rpc-reply does not satisfy, none if all are satisfied
+func checkAssertions(asserts []suite.Assert, rpcReply string) []string {
+	reply := etree.NewDocument()
+	if err := reply.ReadFromString(rpcReply); err != nil || reply.Root() == nil {
+		return []string{"reply is not valid xml"}
+	}
+	// the prefixes of a copy of the reply are rewritten once for each set of namespaces the assertions declare
+	qualified := make(map[string]*etree.Element)
+	var failures []string
+	for idx := range asserts {
+		key := namespacesKey(asserts[idx].Namespaces)
+		root, present := qualified[key]
+		if !present {
+			root = qualifiedCopy(reply.Root(), asserts[idx].Namespaces)
+			qualified[key] = root
+		}
+		if failure := checkAssertion(&asserts[idx], root); failure != "" {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// namespacesKey returns a key identifying the namespaces of an assertion, equal for assertions declaring the same
+// prefixes for the same namespaces
+func namespacesKey(namespaces map[string]string) string {
+	declarations := make([]string, 0, len(namespaces))
+	for prefix, uri := range namespaces {
+		declarations = append(declarations, prefix+"="+uri)
+	}
+	sort.Strings(declarations)
+	return strings.Join(declarations, " ")
+}
+
+// qualifiedCopy returns a copy of the reply with its prefixes rewritten for the namespaces of an assertion
+func qualifiedCopy(reply *etree.Element, namespaces map[string]string) *etree.Element {
+	doc := etree.NewDocument()
+	doc.SetRoot(reply.Copy())
+	prefixes := make(map[string]string, len(namespaces))
+	for prefix, uri := range namespaces {
+		prefixes[uri] = prefix
+	}
+	qualify(doc.Root(), nil, prefixes)
+	return doc.Root()
+}
+
+// checkAssertion returns why the reply, qualified for the namespaces of the assertion, does not satisfy the
+// assertion, empty if it does
+func checkAssertion(a *suite.Assert, reply *etree.Element) string {
+	path, err := etree.CompilePath(a.Path)
+	if err != nil {
+		return a.Path + " is not a valid path"
+	}
+	selected := reply.FindElementsPath(path)
+
+	switch {
+	case a.Exists != nil && !*a.Exists:
+		if len(selected) > 0 {
+			return a.Path + " exists"
+		}
+	case a.Count != nil:
+		if len(selected) != *a.Count {
+			return fmt.Sprintf("%v selected %d elements, expected %d", a.Path, len(selected), *a.Count)
+		}
+	case len(selected) == 0:
+		return a.Path + " does not exist"
+	case a.Equals != nil:
+		for _, e := range selected {
+			if text := strings.TrimSpace(e.Text()); text != *a.Equals {
+				return fmt.Sprintf("%v is '%v', expected '%v'", a.Path, text, *a.Equals)
+			}
+		}
+	case a.Compare != nil:
+		operator, value, err := a.Comparison()
+		if err != nil {
+			return err.Error()
+		}
+		for _, e := range selected {
+			text := strings.TrimSpace(e.Text())
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return fmt.Sprintf("%v is '%v', not a number", a.Path, text)
+			}
+			if !compare(number, operator, value) {
+				return fmt.Sprintf("%v is %v, expected %v", a.Path, text, strings.TrimSpace(*a.Compare))
+			}
+		}
+	}
+	return ""
+}
+
+// compare returns the result of applying a comparison operator to two numbers
+func compare(a float64, operator string, b float64) bool {
+	switch operator {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// qualify replaces the prefix of each element, and of their prefixed attributes, with the prefix an assertion declares
+// for the namespace it resolves to, so that paths match on namespaces rather than on the prefixes the agent chose.
+// Prefixes are removed where the namespace is not declared by the assertion. scope holds the namespace declarations
+// in scope of the element by prefix, the default namespace by the empty prefix
+func qualify(e *etree.Element, scope map[string]string, prefixes map[string]string) {
+	declared := false
+	for _, attr := range e.Attr {
+		if attr.Space == "xmlns" || (attr.Space == "" && attr.Key == "xmlns") {
+			if !declared {
+				inherited := scope
+				scope = make(map[string]string, len(inherited)+1)
+				for prefix, uri := range inherited {
+					scope[prefix] = uri
+				}
+				declared = true
+			}
+			if attr.Space == "xmlns" {
+				scope[attr.Key] = attr.Value
+			} else {
+				scope[""] = attr.Value
+			}
+		}
+	}
+	for idx := range e.Attr {
+		if attr := &e.Attr[idx]; attr.Space != "" && attr.Space != "xmlns" && attr.Space != "xml" {
+			attr.Space = prefixes[scope[attr.Space]]
+		}
+	}
+	e.Space = prefixes[scope[e.Space]]
+	for _, child := range e.ChildElements() {
+		qualify(child, scope, prefixes)
+	}
+}
@@ -0,0 +1,78 @@
+package action
+
+import (
+	"testing"
+
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkAssertions(t *testing.T) {
+	reply := `<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0" xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0" message-id="1">
+  <data>
+    <interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces">
+      <interface><name>eth0</name><mtu> 1500 </mtu></interface>
+      <interface><name>eth1</name><mtu>9000</mtu></interface>
+    </interfaces>
+    <sys:system xmlns:sys="urn:example:system"><sys:hostname>router</sys:hostname></sys:system>
+  </data>
+</rpc-reply>`
+	boolAddr := func(b bool) *bool { return &b }
+	intAddr := func(i int) *int { return &i }
+	ns := map[string]string{"if": "urn:ietf:params:xml:ns:yang:ietf-interfaces", "system": "urn:example:system"}
+	tests := []struct {
+		name    string
+		assert  suite.Assert
+		failure string
+	}{
+		{"exists", suite.Assert{Path: "data/interfaces/interface[name='eth0']"}, ""},
+		{"does not exist", suite.Assert{Path: "data/interfaces/interface[name='eth2']"}, "data/interfaces/interface[name='eth2'] does not exist"},
+		{"not expected to exist", suite.Assert{Path: "//interface[name='eth0']", Exists: boolAddr(false)}, "//interface[name='eth0'] exists"},
+		{"absolute path", suite.Assert{Path: "/rpc-reply/data/interfaces"}, ""},
+		{"count", suite.Assert{Path: "//interface", Count: intAddr(2)}, ""},
+		{"count mismatch", suite.Assert{Path: "//interface", Count: intAddr(3)}, "//interface selected 2 elements, expected 3"},
+		{"equals ignores surrounding whitespace", suite.Assert{Path: "//interface[name='eth0']/mtu", Equals: stringAddr("1500")}, ""},
+		{"equals mismatch", suite.Assert{Path: "//interface/name", Equals: stringAddr("eth0")}, "//interface/name is 'eth1', expected 'eth0'"},
+		{"compare", suite.Assert{Path: "//mtu", Compare: stringAddr(">= 1500")}, ""},
+		{"compare mismatch", suite.Assert{Path: "//mtu", Compare: stringAddr("< 9000")}, "//mtu is 9000, expected < 9000"},
+		{"compare not a number", suite.Assert{Path: "//name", Compare: stringAddr("> 0")}, "//name is 'eth0', not a number"},
+		{"namespace declared with another prefix", suite.Assert{Path: "data/system:system/system:hostname", Namespaces: ns, Equals: stringAddr("router")}, ""},
+		{"namespace", suite.Assert{Path: "data/if:interfaces/if:interface", Namespaces: ns, Count: intAddr(2)}, ""},
+		{"namespace mismatch", suite.Assert{Path: "data/system:interfaces", Namespaces: ns}, "data/system:interfaces does not exist"},
+		{"prefix of the agent is not used", suite.Assert{Path: "data/sys:system"}, "data/sys:system does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := checkAssertions([]suite.Assert{tt.assert}, reply)
+			if tt.failure == "" {
+				assert.Empty(t, failures)
+			} else {
+				assert.Equal(t, []string{tt.failure}, failures)
+			}
+		})
+	}
+
+	t.Run("each failure is reported", func(t *testing.T) {
+		failures := checkAssertions([]suite.Assert{{Path: "//mtu", Count: intAddr(1)}, {Path: "//interface"}, {Path: "//vlan"}}, reply)
+		assert.Equal(t, []string{"//mtu selected 2 elements, expected 1", "//vlan does not exist"}, failures)
+	})
+	t.Run("assertions with other namespaces", func(t *testing.T) {
+		other := map[string]string{"i": "urn:ietf:params:xml:ns:yang:ietf-interfaces"}
+		failures := checkAssertions([]suite.Assert{
+			{Path: "data/if:interfaces", Namespaces: ns},
+			{Path: "data/i:interfaces", Namespaces: other},
+			{Path: "data/if:interfaces", Namespaces: other},
+			{Path: "data/system:system", Namespaces: map[string]string{"system": "urn:example:system", "if": "urn:ietf:params:xml:ns:yang:ietf-interfaces"}},
+		}, reply)
+		assert.Equal(t, []string{"data/if:interfaces does not exist"}, failures)
+	})
+	t.Run("invalid reply", func(t *testing.T) {
+		assert.Equal(t, []string{"reply is not valid xml"}, checkAssertions([]suite.Assert{{Path: "data"}}, "<rpc-reply"))
+	})
+}
+
+func Test_namespacesKey(t *testing.T) {
+	assert.Equal(t, "", namespacesKey(nil))
+	assert.Equal(t, namespacesKey(map[string]string{"a": "urn:a", "b": "urn:b"}), namespacesKey(map[string]string{"b": "urn:b", "a": "urn:a"}))
+	assert.NotEqual(t, namespacesKey(map[string]string{"a": "urn:a"}), namespacesKey(map[string]string{"b": "urn:a"}))
+}
@@ -0,0 +1,127 @@
+package action
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/damianoneill/nc-hammer/suite"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sshAuthMethods returns the authentication methods configured for a host, in the order they should be attempted;
+// private key, ssh-agent, password and keyboard-interactive. Signers are loaded once per run, so that reading and
+// parsing the key or listing the agents keys is not measured as part of each handshake
+func sshAuthMethods(config *suite.Sshconfig) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	if config.PrivateKey != "" {
+		signers, err := loadSigners("privatekey:"+config.PrivateKey+":"+config.Passphrase, func() ([]ssh.Signer, io.Closer, error) {
+			signer, err := loadPrivateKey(config.PrivateKey, config.Passphrase)
+			return []ssh.Signer{signer}, nil, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if config.Agent != "" {
+		socket := os.ExpandEnv(config.Agent)
+		signers, err := loadSigners("agent:"+socket, func() ([]ssh.Signer, io.Closer, error) {
+			return loadAgentSigners(socket)
+		})
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if config.Password != "" {
+		methods = append(methods, ssh.Password(config.Password))
+	}
+	if len(config.KeyboardInteractive) > 0 {
+		methods = append(methods, ssh.KeyboardInteractive(keyboardInteractive(config.KeyboardInteractive)))
+	}
+	return methods, nil
+}
+
+// authSigners are the signers of a private key or an ssh-agent, or the error loading them. The connection to an
+// ssh-agent is kept open as its signers sign through it
+type authSigners struct {
+	signers []ssh.Signer
+	conn    io.Closer
+	err     error
+}
+
+var gSigners = make(map[string]authSigners)
+var gSignersMutex sync.Mutex
+
+// loadSigners returns the signers cached for a key, loading them the first time they are used
+func loadSigners(key string, load func() ([]ssh.Signer, io.Closer, error)) ([]ssh.Signer, error) {
+	gSignersMutex.Lock()
+	defer gSignersMutex.Unlock()
+	loaded, ok := gSigners[key]
+	if !ok {
+		loaded.signers, loaded.conn, loaded.err = load()
+		gSigners[key] = loaded
+	}
+	return loaded.signers, loaded.err
+}
+
+// closeSigners closes the ssh-agent connections and drops the cached signers, so that they are loaded again by the
+// next run
+func closeSigners() {
+	gSignersMutex.Lock()
+	defer gSignersMutex.Unlock()
+	for key, loaded := range gSigners {
+		if loaded.conn != nil {
+			// nolint
+			loaded.conn.Close()
+		}
+		delete(gSigners, key)
+	}
+}
+
+// loadAgentSigners lists the keys held by an ssh-agent, returning the connection their signers sign through
+func loadAgentSigners(socket string) ([]ssh.Signer, io.Closer, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		// nolint
+		conn.Close()
+		return nil, nil, err
+	}
+	return signers, conn, nil
+}
+
+func loadPrivateKey(file, passphrase string) (ssh.Signer, error) {
+	pem, err := ioutil.ReadFile(file) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	}
+	return ssh.ParsePrivateKey(pem)
+}
+
+// keyboardInteractive answers the questions in each challenge with the configured answers in order, the agent may send
+// several challenges (for e.g. a password followed by a one time token) so answers are consumed across challenges
+func keyboardInteractive(answers []string) ssh.KeyboardInteractiveChallenge {
+	next := 0
+	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		replies := make([]string, len(questions))
+		for i := range questions {
+			if next < len(answers) {
+				replies[i] = answers[next]
+				next++
+			}
+		}
+		return replies, nil
+	}
+}
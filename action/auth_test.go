@@ -0,0 +1,105 @@
+package action
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func Test_keyboardInteractive(t *testing.T) {
+	challenge := keyboardInteractive([]string{"pass", "123456"})
+
+	answers, err := challenge("user", "", []string{"Password: "}, []bool{false})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pass"}, answers)
+
+	answers, err = challenge("user", "", []string{"Token: ", "Unexpected: "}, []bool{false, false})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"123456", ""}, answers)
+}
+
+func Test_sshAuthMethods(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nc-hammer-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	keyFile := filepath.Join(dir, "id_ecdsa")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+
+	// serve an in memory keyring as the ssh-agent
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(agent.NewKeyring(), conn)
+		}
+	}()
+
+	tests := []struct {
+		name    string
+		config  suite.Sshconfig
+		methods int
+		wantErr bool
+	}{
+		{"password", suite.Sshconfig{Password: "pass"}, 1, false},
+		{"private key", suite.Sshconfig{PrivateKey: keyFile}, 1, false},
+		{"missing private key", suite.Sshconfig{PrivateKey: filepath.Join(dir, "missing")}, 0, true},
+		{"agent", suite.Sshconfig{Agent: socket}, 1, false},
+		{"missing agent", suite.Sshconfig{Agent: filepath.Join(dir, "missing.sock")}, 0, true},
+		{"all methods", suite.Sshconfig{PrivateKey: keyFile, Agent: socket, Password: "pass", KeyboardInteractive: []string{"pass"}}, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer closeSigners()
+			methods, err := sshAuthMethods(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sshAuthMethods() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Len(t, methods, tt.methods)
+		})
+	}
+
+	t.Run("signers are loaded once", func(t *testing.T) {
+		defer closeSigners()
+		copied := filepath.Join(dir, "id_ecdsa_copy")
+		content, _ := ioutil.ReadFile(keyFile)
+		ioutil.WriteFile(copied, content, 0600)
+		config := suite.Sshconfig{PrivateKey: copied, Agent: socket}
+		_, err := sshAuthMethods(&config)
+		assert.Nil(t, err)
+
+		// neither the key nor the agent are read again
+		os.Remove(copied)
+		listener.Close()
+		methods, err := sshAuthMethods(&config)
+		assert.Nil(t, err)
+		assert.Len(t, methods, 2)
+
+		closeSigners()
+		_, err = sshAuthMethods(&config)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,228 @@
+package action
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1" // #nosec known_hosts hashes hostnames using HMAC-SHA1
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/damianoneill/nc-hammer/suite"
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeyVerificationFailed prefixes the error recorded in a result when a hosts key could not be verified
+const HostKeyVerificationFailed = "host key verification failed"
+
+// hostKeyCallback returns the callback used to verify a hosts key; against a pinned fingerprint, a known_hosts file
+// ($HOME/.ssh/known_hosts if not defined) or not at all if insecure has been explicitly set
+func hostKeyCallback(config *suite.Sshconfig) ssh.HostKeyCallback {
+	switch {
+	case config.Insecure:
+		return ssh.InsecureIgnoreHostKey() // #nosec explicitly requested
+	case config.Fingerprint != "":
+		return fingerprintCallback(config.Fingerprint)
+	case config.KnownHosts != "":
+		return knownHostsCallback(os.ExpandEnv(config.KnownHosts))
+	default:
+		return knownHostsCallback(filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"))
+	}
+}
+
+func hostKeyError(format string, args ...interface{}) error {
+	return fmt.Errorf(HostKeyVerificationFailed+": "+format, args...)
+}
+
+// fingerprintCallback accepts a host key matching the SHA256 (SHA256:...) or MD5 (MD5:aa:bb:...) fingerprint
+func fingerprintCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if ssh.FingerprintSHA256(key) == fingerprint || "MD5:"+ssh.FingerprintLegacyMD5(key) == fingerprint {
+			return nil
+		}
+		return hostKeyError("%v presented %v, expected %v", hostname, ssh.FingerprintSHA256(key), fingerprint)
+	}
+}
+
+// knownHostsCallback accepts a host key matching an entry for the host in an OpenSSH known_hosts file, the file is
+// loaded before the handshake so that it is not measured as part of it
+func knownHostsCallback(file string) ssh.HostKeyCallback {
+	entries, err := loadKnownHosts(file)
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err != nil {
+			return hostKeyError("unable to read known_hosts: %v", err)
+		}
+		return checkKnownHostsEntries(entries, hostname, key)
+	}
+}
+
+// knownHostsEntry is a host key entry of a known_hosts file
+type knownHostsEntry struct {
+	marker string
+	hosts  []string
+	key    []byte
+}
+
+// knownHostsFile is a parsed known_hosts file, or the error reading it
+type knownHostsFile struct {
+	entries []knownHostsEntry
+	err     error
+}
+
+// known_hosts files are read and parsed once per run rather than on each new session, where it would add to the
+// handshake time measured
+var gKnownHosts = make(map[string]knownHostsFile)
+var gKnownHostsMutex sync.Mutex
+
+// loadKnownHosts returns the entries of a known_hosts file, parsing it the first time it is used
+func loadKnownHosts(file string) ([]knownHostsEntry, error) {
+	gKnownHostsMutex.Lock()
+	defer gKnownHostsMutex.Unlock()
+	loaded, ok := gKnownHosts[file]
+	if !ok {
+		content, err := ioutil.ReadFile(file) // #nosec
+		loaded = knownHostsFile{entries: parseKnownHosts(content), err: err}
+		gKnownHosts[file] = loaded
+	}
+	return loaded.entries, loaded.err
+}
+
+// parseKnownHosts returns the host key entries of a known_hosts file, cert-authority entries and lines that cannot be
+// parsed are ignored
+func parseKnownHosts(content []byte) []knownHostsEntry {
+	var entries []knownHostsEntry
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		marker, hosts, pubKey, _, _, err := ssh.ParseKnownHosts([]byte(line))
+		if err != nil || marker == "cert-authority" {
+			continue
+		}
+		entries = append(entries, knownHostsEntry{marker: marker, hosts: hosts, key: pubKey.Marshal()})
+	}
+	return entries
+}
+
+func checkKnownHosts(content []byte, hostname string, key ssh.PublicKey) error {
+	return checkKnownHostsEntries(parseKnownHosts(content), hostname, key)
+}
+
+func checkKnownHostsEntries(entries []knownHostsEntry, hostname string, key ssh.PublicKey) error {
+	names := knownHostsNames(hostname)
+	found, accepted := false, false
+	for _, entry := range entries {
+		if !matchesAnyHost(entry.hosts, names) {
+			continue
+		}
+		sameKey := bytes.Equal(entry.key, key.Marshal())
+		if entry.marker == "revoked" && sameKey {
+			return hostKeyError("%v presented a revoked key %v", hostname, ssh.FingerprintSHA256(key))
+		}
+		accepted = accepted || sameKey
+		found = true
+	}
+	// a revoked entry takes precedence regardless of its position in the file
+	if accepted {
+		return nil
+	}
+	if found {
+		return hostKeyError("%v presented %v which does not match known_hosts, possible man in the middle", hostname, ssh.FingerprintSHA256(key))
+	}
+	return hostKeyError("%v is not in known_hosts, key %v", hostname, ssh.FingerprintSHA256(key))
+}
+
+// knownHostsNames returns the names a host is recorded under in known_hosts, host for port 22 or [host]:port otherwise
+func knownHostsNames(hostname string) []string {
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return []string{hostname}
+	}
+	if port == "22" {
+		return []string{host}
+	}
+	return []string{"[" + host + "]:" + port}
+}
+
+func matchesAnyHost(patterns, names []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		for _, name := range names {
+			if matchesHost(pattern, name) {
+				if negated {
+					return false
+				}
+				matched = true
+			}
+		}
+	}
+	return matched
+}
+
+// matchesHost matches a hostname against a plain, wildcard or hashed (|1|salt|hash) known_hosts pattern
+func matchesHost(pattern, name string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[len("|1|"):], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		// nolint
+		mac.Write([]byte(name))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	return matchesWildcard(pattern, name)
+}
+
+// matchesWildcard matches using the known_hosts wildcards, * for zero or more characters and ? for exactly one
+func matchesWildcard(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(name); i >= 0; i-- {
+				if matchesWildcard(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		default:
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// hostKeyFailure returns the host key verification failure from a dial error without the ssh handshake prefix, or an
+// empty string if the error was not caused by host key verification
+func hostKeyFailure(err error) string {
+	idx := strings.Index(err.Error(), HostKeyVerificationFailed)
+	if idx < 0 {
+		return ""
+	}
+	return err.Error()[idx:]
+}
@@ -0,0 +1,123 @@
+package action
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public
+}
+
+func hashedHost(name string) string {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func Test_checkKnownHosts(t *testing.T) {
+	key := newHostKey(t)
+	other := newHostKey(t)
+	entry := func(hosts string, k ssh.PublicKey) string {
+		return hosts + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k))) + "\n"
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		hostname string
+		err      string
+	}{
+		{"plain host port 22", entry("10.0.0.1", key), "10.0.0.1:22", ""},
+		{"bracketed host and port", entry("[10.0.0.1]:830", key), "10.0.0.1:830", ""},
+		{"hashed host", entry(hashedHost("[10.0.0.1]:830"), key), "10.0.0.1:830", ""},
+		{"wildcard host", entry("[10.0.0.*]:830", key), "10.0.0.1:830", ""},
+		{"negated host", entry("[10.0.0.*]:830,![10.0.0.1]:830", key), "10.0.0.1:830", "is not in known_hosts"},
+		{"unknown host", entry("[10.0.0.2]:830", key), "10.0.0.1:830", "is not in known_hosts"},
+		{"key mismatch", "# comment\n" + entry("[10.0.0.1]:830", other), "10.0.0.1:830", "does not match known_hosts"},
+		{"revoked key", entry("[10.0.0.1]:830", key) + "@revoked " + entry("[10.0.0.1]:830", key), "10.0.0.1:830", "presented a revoked key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkKnownHosts([]byte(tt.content), tt.hostname, key)
+			if tt.err == "" {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.True(t, strings.HasPrefix(err.Error(), HostKeyVerificationFailed))
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func Test_hostKeyCallback(t *testing.T) {
+	key := newHostKey(t)
+	other := newHostKey(t)
+
+	dir, err := ioutil.TempDir("", "nc-hammer-hostkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	ioutil.WriteFile(knownHosts, []byte("[10.0.0.1]:830 "+string(ssh.MarshalAuthorizedKey(key))), 0600)
+
+	tests := []struct {
+		name   string
+		config suite.Sshconfig
+		key    ssh.PublicKey
+		valid  bool
+	}{
+		{"insecure", suite.Sshconfig{Insecure: true}, other, true},
+		{"sha256 fingerprint", suite.Sshconfig{Fingerprint: ssh.FingerprintSHA256(key)}, key, true},
+		{"md5 fingerprint", suite.Sshconfig{Fingerprint: "MD5:" + ssh.FingerprintLegacyMD5(key)}, key, true},
+		{"fingerprint mismatch", suite.Sshconfig{Fingerprint: ssh.FingerprintSHA256(key)}, other, false},
+		{"known hosts", suite.Sshconfig{KnownHosts: knownHosts}, key, true},
+		{"known hosts mismatch", suite.Sshconfig{KnownHosts: knownHosts}, other, false},
+		{"known hosts missing", suite.Sshconfig{KnownHosts: filepath.Join(dir, "missing")}, key, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := hostKeyCallback(&tt.config)("10.0.0.1:830", &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 830}, tt.key)
+			assert.Equal(t, tt.valid, err == nil)
+		})
+	}
+	t.Run("known hosts is parsed once", func(t *testing.T) {
+		// the file has been parsed, so a change to it is not seen by later sessions
+		ioutil.WriteFile(knownHosts, []byte("[10.0.0.1]:830 "+string(ssh.MarshalAuthorizedKey(other))), 0600)
+		config := suite.Sshconfig{KnownHosts: knownHosts}
+		assert.Nil(t, hostKeyCallback(&config)("10.0.0.1:830", &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 830}, key))
+	})
+}
+
+func Test_hostKeyFailure(t *testing.T) {
+	assert.Equal(t, HostKeyVerificationFailed+": 10.0.0.1:830 is not in known_hosts",
+		hostKeyFailure(errors.New("ssh: handshake failed: "+HostKeyVerificationFailed+": 10.0.0.1:830 is not in known_hosts")))
+	assert.Equal(t, "", hostKeyFailure(errors.New("ssh: handshake failed: ssh: unable to authenticate")))
+}
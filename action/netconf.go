@@ -2,17 +2,31 @@ package action
 
 import (
 	"fmt"
+	"io"
+	"net"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Juniper/go-netconf/netconf"
+	"github.com/beevik/etree"
 	"github.com/damianoneill/nc-hammer/result"
 	"github.com/damianoneill/nc-hammer/suite"
-	"golang.org/x/crypto/ssh"
+)
+
+// Errors recorded in a result, prefixes are followed by the detail of the error
+const (
+	SessionClosed    = "session closed by remote side"
+	ExpectedMismatch = "expected response did not match"
+	InvalidExpected  = "expected is not a valid regular expression"
+	XMLRenderFailed  = "request could not be rendered as xml"
+	ConnectTimedOut  = "connection timed out"
 )
 
 var gSessions map[string]*netconf.Session
+var gSessionsMutex sync.Mutex
 
 func init() {
 	gSessions = make(map[string]*netconf.Session)
@@ -20,9 +34,50 @@ func init() {
 
 // CloseAllSessions is called on exit to gracefully close the sockets
 func CloseAllSessions() {
+	gSessionsMutex.Lock()
+	defer gSessionsMutex.Unlock()
 	// nolint
-	for _, session := range gSessions {
+	for key, session := range gSessions {
 		session.Close()
+		delete(gSessions, key)
+	}
+	closeSigners()
+}
+
+// sessionKey identifies a cached session for a client/host pair
+func sessionKey(client int, hostname string) string {
+	return strconv.Itoa(client) + hostname
+}
+
+// clientSessionID returns the session-id of the session a client holds to a host, only sessions that are reused are
+// held between requests
+func clientSessionID(client int, hostname string) (int, bool) {
+	gSessionsMutex.Lock()
+	defer gSessionsMutex.Unlock()
+	session, present := gSessions[sessionKey(client, hostname)]
+	if !present || session == nil {
+		return 0, false
+	}
+	return session.SessionID, true
+}
+
+// removeSession drops a cached session for a client/host pair, closing it if requested
+func removeSession(client int, hostname string, close bool) {
+	gSessionsMutex.Lock()
+	defer gSessionsMutex.Unlock()
+	if session, present := gSessions[sessionKey(client, hostname)]; present {
+		delete(gSessions, sessionKey(client, hostname))
+		if close {
+			// nolint
+			session.Close()
+		}
+	}
+}
+
+// CloseClientSessions closes the sessions cached for a client, used when a client stops before the end of a run
+func CloseClientSessions(client int, configs suite.Configs) {
+	for idx := range configs {
+		removeSession(client, configs[idx].Hostname+":"+strconv.Itoa(configs[idx].Port), true)
 	}
 }
 
@@ -38,102 +93,220 @@ func ExecuteNetconf(tsStart time.Time, cID int, action suite.Action, config *sui
 
 	var result result.NetconfResult
 	result.Client = cID
+	result.Sent = toMilliseconds(time.Since(tsStart))
 	result.Hostname = action.Netconf.Hostname
 	result.Operation = operationOrMessage(action.Netconf)
+	if action.Netconf.Datastore != nil {
+		result.Datastore = *action.Netconf.Datastore
+	}
+	if action.Netconf.WithDefaults != nil {
+		result.WithDefaults = *action.Netconf.WithDefaults
+	}
 
-	session, err := getSession(cID, config.Hostname+":"+strconv.Itoa(config.Port), config.Username, config.Password, config.Reuseconnection)
+	hostname := config.Hostname + ":" + strconv.Itoa(config.Port)
+	// a subscribed session is dedicated to receiving notifications so is never reused
+	reuseConnection := config.Reuseconnection && !action.Netconf.IsSubscription()
+	session, timings, err := getSession(cID, config, reuseConnection)
 	if err != nil {
 		fmt.Printf("E")
+		result.When = toMilliseconds(time.Since(tsStart))
 		result.Err = err.Error()
+		if failure := hostKeyFailure(err); failure != "" {
+			result.Err = failure
+		} else if isTimeout(err) {
+			result.Err = ConnectTimedOut + ": " + err.Error()
+		}
 		resultChannel <- result
 		return
 	}
 
 	// not reusing the connection, then explicitly close it
-	if !config.Reuseconnection {
+	if !reuseConnection {
 		// nolint
 		defer session.Close()
 	}
 
+	if timings != nil {
+		result.Connect = toMilliseconds(timings.Connect)
+		result.Handshake = toMilliseconds(timings.Handshake)
+		result.Hello = toMilliseconds(timings.Hello)
+	}
+
 	if session != nil {
 		result.SessionID = session.SessionID
 	} else {
 		fmt.Printf("E")
+		result.When = toMilliseconds(time.Since(tsStart))
 		result.Err = "session has expired"
 		resultChannel <- result
 		return
 	}
 
+	// the session of another client to kill is resolved now, as its session-id is only known once it is established
+	if action.Netconf.SessionClient != nil {
+		id, present := clientSessionID(*action.Netconf.SessionClient, hostname)
+		if !present {
+			fmt.Printf("E")
+			result.When = toMilliseconds(time.Since(tsStart))
+			result.Err = fmt.Sprintf("client %d does not hold a session to %v", *action.Netconf.SessionClient, action.Netconf.Hostname)
+			resultChannel <- result
+			return
+		}
+		resolved := *action.Netconf
+		resolved.SessionID, resolved.SessionClient = &id, nil
+		action.Netconf = &resolved
+	}
+
 	xml, err := action.Netconf.ToXMLString()
 	if err != nil {
 		fmt.Printf("E")
-		result.Err = err.Error()
+		result.When = toMilliseconds(time.Since(tsStart))
+		result.Err = XMLRenderFailed + ": " + err.Error()
 		resultChannel <- result
 		return
 	}
 
 	raw := netconf.RawMethod(xml)
 	start := time.Now()
+	result.Sent = toMilliseconds(start.Sub(tsStart))
 	rpcReply, err := session.Exec(raw)
 	if err != nil {
-		if err.Error() == "WaitForFunc failed" {
-			delete(gSessions, strconv.Itoa(cID)+config.Hostname+":"+strconv.Itoa(config.Port))
-			result.Err = "session closed by remote side"
+		result.When = toMilliseconds(time.Since(tsStart))
+		if isSessionClosed(err) {
+			removeSession(cID, hostname, false)
+			result.Err = SessionClosed
+		} else if isFramingError(err) {
+			// the reply cannot be delimited so the next on the session cannot be either
+			removeSession(cID, hostname, true)
+			result.Err = err.Error()
 		} else {
 			result.Err = err.Error()
+			if rpcErr, ok := err.(*netconf.RPCError); ok {
+				recordRPCError(rpcErr, &result)
+			}
 		}
 		fmt.Printf("e")
 		resultChannel <- result
 		return
 	}
 	elapsed := time.Since(start)
-	result.When = float64(time.Since(tsStart).Nanoseconds() / int64(time.Millisecond))
-	result.Latency = float64(elapsed.Nanoseconds() / int64(time.Millisecond))
+	result.When = toMilliseconds(time.Since(tsStart))
+	result.Latency = toMilliseconds(elapsed)
 
 	result.MessageID = rpcReply.MessageID
 
+	// the agent has terminated the session, a reused connection needs to be reestablished on the next request
+	if result.Operation == "close-session" && config.Reuseconnection {
+		removeSession(cID, hostname, true)
+	}
+
 	if action.Netconf.Expected != nil {
 		match, err := regexp.MatchString(*action.Netconf.Expected, rpcReply.Data)
 		if err != nil {
 			fmt.Printf("E")
-			result.Err = err.Error()
+			result.Err = InvalidExpected + ": " + err.Error()
 			resultChannel <- result
 			return
 		}
 		if !match {
 			fmt.Printf("e")
-			result.Err = "expected response did not match, expected: " + *action.Netconf.Expected + " actual: " + rpcReply.Data
+			result.Err = ExpectedMismatch + ", expected: " + *action.Netconf.Expected + " actual: " + rpcReply.Data
+			resultChannel <- result
+			return
+		}
+	}
+	if len(action.Netconf.Assert) > 0 {
+		if failures := checkAssertions(action.Netconf.Assert, rpcReply.RawReply); len(failures) > 0 {
+			fmt.Printf("e")
+			result.Err = AssertionFailed + ": " + strings.Join(failures, "; ")
 			resultChannel <- result
 			return
 		}
 	}
 	resultChannel <- result
+
+	if action.Netconf.IsSubscription() && action.Netconf.Listen != nil {
+		listenForNotifications(tsStart, cID, session, action.Netconf, resultChannel)
+	}
+}
+
+// recordRPCError records the fields of an rpc-error returned by the agent, go-netconf does not parse the error-app-tag
+// so it is read from the contents of the rpc-error
+func recordRPCError(rpcErr *netconf.RPCError, r *result.NetconfResult) {
+	r.ErrorType = strings.TrimSpace(rpcErr.Type)
+	r.ErrorTag = strings.TrimSpace(rpcErr.Tag)
+	r.ErrorSeverity = strings.TrimSpace(rpcErr.Severity)
+	r.ErrorPath = strings.TrimSpace(rpcErr.Path)
+	r.ErrorMessage = strings.TrimSpace(rpcErr.Message)
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString("<rpc-error>" + rpcErr.Info + "</rpc-error>"); err == nil {
+		if appTag := doc.Root().SelectElement("error-app-tag"); appTag != nil {
+			r.ErrorAppTag = strings.TrimSpace(appTag.Text())
+		}
+	}
+}
+
+// setupTimings records the time taken to establish a new session, the handshake is the SSH handshake and authentication
+// or the TLS handshake depending on the transport
+type setupTimings struct {
+	Connect   time.Duration
+	Handshake time.Duration
+	Hello     time.Duration
 }
 
-// getSession returns a NETCONF Session, either a new one or a pre existing one if resuseConnection is valid for client/host
-func getSession(client int, hostname, username, password string, reuseConnection bool) (*netconf.Session, error) {
+// toMilliseconds converts a duration to fractional milliseconds, latencies and setup timings are often sub millisecond
+// on a local network or against a simulator
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / float64(time.Millisecond)
+}
+
+// getSession returns a NETCONF Session, either a new one or a pre existing one if resuseConnection is valid for client/host.
+// Timings are returned only when a new session has been established
+func getSession(client int, config *suite.Sshconfig, reuseConnection bool) (*netconf.Session, *setupTimings, error) {
+	hostname := config.Hostname + ":" + strconv.Itoa(config.Port)
 	// check if hostname should reuse connection
 	if reuseConnection {
 		// get Session from Map if present
-		session, present := gSessions[strconv.Itoa(client)+hostname]
+		gSessionsMutex.Lock()
+		session, present := gSessions[sessionKey(client, hostname)]
+		gSessionsMutex.Unlock()
 		if present {
-			return session, nil
+			return session, nil, nil
 		}
 		// not present in map, therefore first time its called, create a new session and store in map
-		session, err := createNewSession(hostname, username, password)
+		session, timings, err := createNewSession(hostname, config)
 		if err == nil {
-			gSessions[strconv.Itoa(client)+hostname] = session
+			gSessionsMutex.Lock()
+			gSessions[sessionKey(client, hostname)] = session
+			gSessionsMutex.Unlock()
 		}
-		return session, nil
+		return session, timings, err
 	}
-	return createNewSession(hostname, username, password)
+	return createNewSession(hostname, config)
 }
 
-func createNewSession(hostname, username, password string) (*netconf.Session, error) {
-	sshConfig := &ssh.ClientConfig{
-		User:            username,
-		Auth:            []ssh.AuthMethod{ssh.Password(password)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+func createNewSession(hostname string, config *suite.Sshconfig) (*netconf.Session, *setupTimings, error) {
+	if config.Transport == suite.TransportTLS {
+		return dialTLS(hostname, config)
 	}
-	return netconf.DialSSH(hostname, sshConfig)
+	return dialSSH(hostname, config)
+}
+
+// isTimeout returns true if establishing a session failed as the agent did not respond within the connect timeout, the
+// ssh handshake wraps the error so it is also matched by the suffix of its message
+func isTimeout(err error) bool {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return strings.HasSuffix(err.Error(), "i/o timeout")
+}
+
+// isFramingError returns true if a reply could not be received as its chunked framing is malformed
+func isFramingError(err error) bool {
+	return err == errMalformedChunkHeader || err == errMalformedChunkSize
+}
+
+// isSessionClosed returns true if the error indicates the agent has closed the session
+func isSessionClosed(err error) bool {
+	return err.Error() == "WaitForFunc failed" || err == io.EOF || err == io.ErrUnexpectedEOF
 }
@@ -0,0 +1,106 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Juniper/go-netconf/netconf"
+	"github.com/beevik/etree"
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+)
+
+// NotificationOperation is the operation recorded against results for notifications received on a subscription
+const NotificationOperation = "notification"
+
+// listenForNotifications receives notifications on a subscribed session for the listen period defined in the action,
+// a result is recorded for each notification received with the latency being the delay between its eventTime and receipt
+func listenForNotifications(tsStart time.Time, cID int, session *netconf.Session, n *suite.Netconf, resultChannel chan result.NetconfResult) {
+	messages := make(chan []byte)
+	errs := make(chan error, 1)
+	quit := make(chan bool)
+	defer close(quit)
+
+	// the transport receive blocks, so read in a separate goroutine, this exits when the session is closed
+	go func() {
+		for {
+			raw, err := session.Transport.Receive()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case messages <- raw:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	listen := time.After(time.Duration(*n.Listen) * time.Millisecond)
+	for {
+		select {
+		case <-listen:
+			return
+		case raw := <-messages:
+			received := time.Now()
+			eventTime, err := parseNotification(raw)
+			if err == errNotANotification {
+				continue
+			}
+			result := newNotificationResult(cID, session, n)
+			result.When = toMilliseconds(received.Sub(tsStart))
+			if err != nil {
+				fmt.Printf("e")
+				result.Err = err.Error()
+			} else {
+				result.Latency = toMilliseconds(received.Sub(eventTime))
+			}
+			resultChannel <- result
+		case err := <-errs:
+			result := newNotificationResult(cID, session, n)
+			result.When = toMilliseconds(time.Since(tsStart))
+			if isSessionClosed(err) {
+				result.Err = SessionClosed
+			} else {
+				result.Err = err.Error()
+			}
+			fmt.Printf("e")
+			resultChannel <- result
+			return
+		}
+	}
+}
+
+func newNotificationResult(cID int, session *netconf.Session, n *suite.Netconf) result.NetconfResult {
+	var result result.NetconfResult
+	result.Client = cID
+	result.SessionID = session.SessionID
+	result.Hostname = n.Hostname
+	result.Operation = NotificationOperation
+	result.Stream = n.SubscribedStream()
+	if n.Datastore != nil {
+		result.Datastore = *n.Datastore
+	}
+	return result
+}
+
+var errNotANotification = errors.New("message is not a notification")
+
+// parseNotification returns the eventTime of a notification message
+func parseNotification(raw []byte) (time.Time, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil || doc.Root() == nil || doc.Root().Tag != "notification" {
+		return time.Time{}, errNotANotification
+	}
+	eventTime := doc.Root().SelectElement("eventTime")
+	if eventTime == nil {
+		return time.Time{}, errors.New("notification does not contain an eventTime")
+	}
+	when, err := time.Parse(time.RFC3339Nano, eventTime.Text())
+	if err != nil {
+		return time.Time{}, errors.New("notification eventTime is not valid: " + eventTime.Text())
+	}
+	return when, nil
+}
@@ -0,0 +1,107 @@
+package action
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/Juniper/go-netconf/netconf"
+	"github.com/damianoneill/nc-hammer/suite"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshNetconfSubsystem is the ssh subsystem NETCONF is requested over (RFC 6242)
+const sshNetconfSubsystem = "netconf"
+
+// dialSSH creates a new NETCONF session over SSH, the TCP connect, SSH handshake (including authentication and opening
+// the netconf subsystem) and hello exchange are timed separately, so it is not established through netconf.DialSSH
+func dialSSH(hostname string, config *suite.Sshconfig) (*netconf.Session, *setupTimings, error) {
+	auth, err := sshAuthMethods(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	sshConfig := &ssh.ClientConfig{
+		User:            config.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback(config),
+	}
+
+	timings := &setupTimings{}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", hostname, config.GetConnectTimeout())
+	if err != nil {
+		return nil, nil, err
+	}
+	timings.Connect = time.Since(start)
+
+	// the handshake and hello exchange are bounded by the connect timeout, cleared once the session is established
+	// nolint
+	conn.SetDeadline(time.Now().Add(config.GetConnectTimeout()))
+	start = time.Now()
+	sc, err := newSSHConn(conn, hostname, sshConfig)
+	if err != nil {
+		// nolint
+		conn.Close()
+		return nil, nil, err
+	}
+	timings.Handshake = time.Since(start)
+
+	start = time.Now()
+	session, err := newSession(newTransport(sc))
+	if err != nil {
+		// nolint
+		sc.Close()
+		return nil, nil, err
+	}
+	timings.Hello = time.Since(start)
+	// nolint
+	conn.SetDeadline(time.Time{})
+	return session, timings, nil
+}
+
+// sshConn is the netconf subsystem channel of an ssh client, closing it closes the channel and the client
+type sshConn struct {
+	io.Reader
+	io.WriteCloser
+	client  *ssh.Client
+	session *ssh.Session
+}
+
+func newSSHConn(conn net.Conn, hostname string, config *ssh.ClientConfig) (*sshConn, error) {
+	c, chans, reqs, err := ssh.NewClientConn(conn, hostname, config)
+	if err != nil {
+		return nil, err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	session, err := client.NewSession()
+	if err != nil {
+		// nolint
+		client.Close()
+		return nil, err
+	}
+	writer, err := session.StdinPipe()
+	if err != nil {
+		// nolint
+		client.Close()
+		return nil, err
+	}
+	reader, err := session.StdoutPipe()
+	if err != nil {
+		// nolint
+		client.Close()
+		return nil, err
+	}
+	if err = session.RequestSubsystem(sshNetconfSubsystem); err != nil {
+		// nolint
+		client.Close()
+		return nil, err
+	}
+	return &sshConn{Reader: reader, WriteCloser: writer, client: client, session: session}, nil
+}
+
+// Close closes the netconf channel and the underlying ssh connection
+func (c *sshConn) Close() error {
+	// nolint
+	c.session.Close()
+	return c.client.Close()
+}
@@ -0,0 +1,236 @@
+package action
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/simulator"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveSSH accepts a single connection, authenticating with a password and serving the netconf subsystem
+func serveSSH(listener net.Listener, config *ssh.ServerConfig) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				// nolint
+				req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == sshNetconfSubsystem, nil)
+			}
+		}()
+		go serveNetconf(channel)
+	}
+}
+
+func Test_ExecuteNetconfSSH(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		err         string
+	}{
+		{"pinned fingerprint", ssh.FingerprintSHA256(signer.PublicKey()), ""},
+		{"fingerprint mismatch", "SHA256:mismatch", HostKeyVerificationFailed + ": "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			go serveSSH(listener, serverConfig)
+
+			config := &suite.Sshconfig{Hostname: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, Username: "uname", Password: "pass", Fingerprint: tt.fingerprint}
+			a := suite.Action{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: stringAddr("get")}}
+			resultChannel := make(chan result.NetconfResult, 1)
+			ExecuteNetconf(time.Now(), 0, a, config, resultChannel)
+
+			r := <-resultChannel
+			if tt.err != "" {
+				assert.Contains(t, r.Err, tt.err)
+				assert.Equal(t, 0.0, r.Connect)
+				return
+			}
+			assert.Equal(t, "", r.Err)
+			assert.Equal(t, 99, r.SessionID)
+			assert.True(t, r.Connect > 0 && r.Handshake > 0 && r.Hello > 0)
+		})
+	}
+}
+
+func Test_ExecuteNetconfSimulatorFaults(t *testing.T) {
+	hostKey, err := simulator.NewHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := simulator.New("admin", "admin", hostKey)
+	err = sim.AddRules(
+		simulator.Rule{Operation: "commit", Drop: true},
+		simulator.Rule{Operation: "validate", Malformed: true},
+		simulator.Rule{Operation: "discard-changes", Error: &simulator.RPCError{Tag: "resource-denied", AppTag: "memory", Path: "/system", Message: "out of memory"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// nolint
+	go sim.Serve(listener)
+
+	config := &suite.Sshconfig{Hostname: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, Username: "admin", Password: "admin",
+		Reuseconnection: true, Fingerprint: ssh.FingerprintSHA256(hostKey.PublicKey())}
+	execute := func(operation string) result.NetconfResult {
+		resultChannel := make(chan result.NetconfResult, 1)
+		a := suite.Action{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: stringAddr(operation)}}
+		ExecuteNetconf(time.Now(), 0, a, config, resultChannel)
+		return <-resultChannel
+	}
+	defer CloseAllSessions()
+
+	tests := []struct {
+		operation     string
+		err           string
+		reestablished bool
+	}{
+		{"commit", "session closed by remote side", true},
+		// the simulator uses chunked framing as both advertise base:1.1, a malformed chunk is detected before it closes
+		{"validate", "malformed chunk size", true},
+		{"discard-changes", "netconf rpc [error] 'out of memory'", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			before := execute("get")
+			assert.Equal(t, "", before.Err)
+			assert.Equal(t, tt.err, execute(tt.operation).Err)
+			// a session closed by the agent, or closed after a framing error, is reestablished for the next request
+			after := execute("get")
+			assert.Equal(t, "", after.Err)
+			assert.Equal(t, tt.reestablished, after.SessionID != before.SessionID)
+		})
+	}
+
+	t.Run("rpc-error fields are recorded", func(t *testing.T) {
+		r := execute("discard-changes")
+		assert.Equal(t, "application", r.ErrorType)
+		assert.Equal(t, "resource-denied", r.ErrorTag)
+		assert.Equal(t, "error", r.ErrorSeverity)
+		assert.Equal(t, "memory", r.ErrorAppTag)
+		assert.Equal(t, "/system", r.ErrorPath)
+		assert.Equal(t, "out of memory", r.ErrorMessage)
+	})
+
+	t.Run("assertions of the reply", func(t *testing.T) {
+		resultChannel := make(chan result.NetconfResult, 1)
+		a := suite.Action{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: stringAddr("get"), Assert: []suite.Assert{
+			{Path: "/rpc-reply/data", Namespaces: map[string]string{"nc": "urn:ietf:params:xml:ns:netconf:base:1.0"}},
+			{Path: "nc:data/interfaces", Namespaces: map[string]string{"nc": "urn:ietf:params:xml:ns:netconf:base:1.0"}},
+		}}}
+		ExecuteNetconf(time.Now(), 0, a, config, resultChannel)
+		assert.Equal(t, AssertionFailed+": nc:data/interfaces does not exist", (<-resultChannel).Err)
+	})
+
+	t.Run("kill the session of another client", func(t *testing.T) {
+		resultChannel := make(chan result.NetconfResult, 1)
+		get := suite.Action{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: stringAddr("get")}}
+		ExecuteNetconf(time.Now(), 1, get, config, resultChannel)
+		before := <-resultChannel
+		assert.Equal(t, "", before.Err)
+
+		client := 1
+		kill := suite.Action{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: stringAddr("kill-session"), SessionClient: &client}}
+		ExecuteNetconf(time.Now(), 0, kill, config, resultChannel)
+		assert.Equal(t, "", (<-resultChannel).Err)
+		assert.Nil(t, kill.Netconf.SessionID)
+
+		// the killed session is closed by the agent, client 1 reestablishes it
+		ExecuteNetconf(time.Now(), 1, get, config, resultChannel)
+		assert.NotEqual(t, "", (<-resultChannel).Err)
+		ExecuteNetconf(time.Now(), 1, get, config, resultChannel)
+		after := <-resultChannel
+		assert.Equal(t, "", after.Err)
+		assert.NotEqual(t, before.SessionID, after.SessionID)
+
+		absent := 5
+		kill.Netconf.SessionClient = &absent
+		ExecuteNetconf(time.Now(), 0, kill, config, resultChannel)
+		assert.Equal(t, "client 5 does not hold a session to 127.0.0.1", (<-resultChannel).Err)
+	})
+
+	t.Run("invalid expected", func(t *testing.T) {
+		resultChannel := make(chan result.NetconfResult, 1)
+		a := suite.Action{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: stringAddr("get"), Expected: stringAddr("(<data")}}
+		ExecuteNetconf(time.Now(), 0, a, config, resultChannel)
+		assert.Equal(t, InvalidExpected+": error parsing regexp: missing closing ): `(<data`", (<-resultChannel).Err)
+	})
+
+	t.Run("session limit", func(t *testing.T) {
+		sim.SetMaxSessions(1)
+		defer sim.SetMaxSessions(0)
+		assert.Equal(t, "", execute("get").Err)
+		config.Reuseconnection = false
+		defer func() { config.Reuseconnection = true }()
+		assert.Contains(t, execute("get").Err, "resource shortage")
+	})
+}
+
+func Test_ExecuteNetconfConnectTimeout(t *testing.T) {
+	// the agent accepts the connection but never starts the ssh handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		<-done
+	}()
+
+	config := &suite.Sshconfig{Hostname: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, Username: "uname", Password: "pass", Insecure: true, ConnectTimeout: 1}
+	a := suite.Action{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: stringAddr("get")}}
+	resultChannel := make(chan result.NetconfResult, 1)
+	ExecuteNetconf(time.Now(), 0, a, config, resultChannel)
+	assert.Contains(t, (<-resultChannel).Err, ConnectTimedOut+": ")
+}
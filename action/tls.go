@@ -0,0 +1,79 @@
+package action
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/Juniper/go-netconf/netconf"
+	"github.com/damianoneill/nc-hammer/suite"
+)
+
+// dialTLS creates a new NETCONF session over TLS (RFC 7589) using mutual X.509 authentication, the TCP connect, TLS
+// handshake and hello exchange are timed separately
+func dialTLS(hostname string, config *suite.Sshconfig) (*netconf.Session, *setupTimings, error) {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timings := &setupTimings{}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", hostname, config.GetConnectTimeout())
+	if err != nil {
+		return nil, nil, err
+	}
+	timings.Connect = time.Since(start)
+
+	// the handshake and hello exchange are bounded by the connect timeout, cleared once the session is established
+	// nolint
+	conn.SetDeadline(time.Now().Add(config.GetConnectTimeout()))
+	start = time.Now()
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err = tlsConn.Handshake(); err != nil {
+		// nolint
+		conn.Close()
+		return nil, nil, err
+	}
+	timings.Handshake = time.Since(start)
+
+	start = time.Now()
+	session, err := newSession(newTransport(tlsConn))
+	if err != nil {
+		// nolint
+		tlsConn.Close()
+		return nil, nil, err
+	}
+	timings.Hello = time.Since(start)
+	// nolint
+	conn.SetDeadline(time.Time{})
+	return session, timings, nil
+}
+
+// newTLSConfig loads the client certificate and the CA used to verify the agent, the system roots are used when a CA
+// is not defined
+func newTLSConfig(config *suite.Sshconfig) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(config.Certificate, config.Key)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ServerName:   config.Hostname,
+	}
+	if config.CA != "" {
+		pem, err := ioutil.ReadFile(config.CA) // #nosec
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("tls: no certificates found in CA file " + config.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,131 @@
+package action
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate generates a key pair signed by the parent (or self signed if nil) and writes both as PEM files
+func writeCertificate(t *testing.T, dir, name string, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	certificate, _ := x509.ParseCertificate(der)
+	return certificate, key
+}
+
+func newTemplate(serial int64, name string, ca bool) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if ca {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	return template
+}
+
+// serveTLS accepts a single connection, exchanges hellos and replies ok to each rpc received
+func serveTLS(listener net.Listener) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	serveNetconf(conn)
+}
+
+// serveNetconf exchanges hellos and replies ok to each rpc received
+func serveNetconf(conn io.ReadWriteCloser) {
+	server := newTransport(conn)
+	defer server.Close()
+	server.Send([]byte(`<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities><capability>urn:ietf:params:netconf:base:1.0</capability></capabilities><session-id>99</session-id></hello>`))
+	if _, err := server.ReceiveHello(); err != nil {
+		return
+	}
+	for {
+		if _, err := server.Receive(); err != nil {
+			return
+		}
+		server.Send([]byte(`<rpc-reply xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`))
+	}
+}
+
+func Test_ExecuteNetconfTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nc-hammer-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca, caKey := writeCertificate(t, dir, "ca", newTemplate(1, "ca", true), nil, nil)
+	writeCertificate(t, dir, "server", newTemplate(2, "agent", false), ca, caKey)
+	writeCertificate(t, dir, "client", newTemplate(3, "nc-hammer", false), ca, caKey)
+
+	serverCertificate, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCertificate}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go serveTLS(listener)
+
+	config := &suite.Sshconfig{Hostname: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, Transport: suite.TransportTLS, CA: filepath.Join(dir, "ca.pem"), Certificate: filepath.Join(dir, "client.pem"), Key: filepath.Join(dir, "client-key.pem")}
+	a := suite.Action{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: stringAddr("get")}}
+	resultChannel := make(chan result.NetconfResult, 1)
+	ExecuteNetconf(time.Now(), 0, a, config, resultChannel)
+
+	r := <-resultChannel
+	assert.Equal(t, "", r.Err)
+	assert.Equal(t, 99, r.SessionID)
+	assert.Equal(t, "get", r.Operation)
+	assert.True(t, r.Connect > 0 && r.Handshake > 0 && r.Hello > 0)
+	// a local request completes in under a millisecond, which is recorded rather than truncated to zero
+	assert.True(t, r.Latency > 0 && r.When > 0)
+}
+
+func Test_newTLSConfigMissingCertificate(t *testing.T) {
+	_, err := newTLSConfig(&suite.Sshconfig{Hostname: "127.0.0.1", Certificate: "missing.pem", Key: "missing-key.pem"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,151 @@
+package action
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/Juniper/go-netconf/netconf"
+)
+
+// msgSeparator is the NETCONF 1.0 end-of-message delimiter
+const msgSeparator = "]]>]]>"
+
+// base capabilities advertised in the clients hello, chunked framing is used when the agent also advertises base:1.1
+const (
+	base10Capability = "urn:ietf:params:netconf:base:1.0"
+	base11Capability = "urn:ietf:params:netconf:base:1.1"
+)
+
+// errors receiving a chunked message, the session cannot recover from a framing error so is closed
+var (
+	errMalformedChunkHeader = errors.New("malformed chunk header")
+	errMalformedChunkSize   = errors.New("malformed chunk size")
+)
+
+// transport implements NETCONF framing over a connection, end-of-message framing is used until both peers have
+// advertised base:1.1 in their hello, chunked framing (RFC 6242 section 4.2) after. The go-netconf basic io transport
+// is not exported, so this is used for connections that are not established through netconf.DialSSH
+type transport struct {
+	conn    io.ReadWriteCloser
+	reader  *bufio.Reader
+	chunked bool
+}
+
+func newTransport(conn io.ReadWriteCloser) *transport {
+	return &transport{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// Send writes a message framed for the current framing mode
+func (t *transport) Send(data []byte) error {
+	var framed bytes.Buffer
+	if t.chunked {
+		fmt.Fprintf(&framed, "\n#%d\n", len(data))
+		framed.Write(data)
+		framed.WriteString("\n##\n")
+	} else {
+		framed.Write(data)
+		framed.WriteString(msgSeparator + "\n")
+	}
+	_, err := t.conn.Write(framed.Bytes())
+	return err
+}
+
+// Receive reads a message framed for the current framing mode, returning the message without the framing
+func (t *transport) Receive() ([]byte, error) {
+	if t.chunked {
+		return t.receiveChunked()
+	}
+	var message []byte
+	for {
+		chunk, err := t.reader.ReadBytes('>')
+		message = append(message, chunk...)
+		if bytes.HasSuffix(message, []byte(msgSeparator)) {
+			return bytes.TrimSpace(message[:len(message)-len(msgSeparator)]), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// receiveChunked reads chunks until the end-of-chunks marker
+func (t *transport) receiveChunked() ([]byte, error) {
+	var message []byte
+	for {
+		header, err := t.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		// the line feed preceding a chunk header is read as an empty line, as is the one following the end-of-message
+		// delimiter of the hello
+		for header == "\n" {
+			if header, err = t.reader.ReadString('\n'); err != nil {
+				return nil, err
+			}
+		}
+		if header == "##\n" {
+			return message, nil
+		}
+		if len(header) < 3 || header[0] != '#' {
+			return nil, errMalformedChunkHeader
+		}
+		// chunk sizes are at most 4294967295 octets
+		size, err := strconv.ParseUint(header[1:len(header)-1], 10, 32)
+		if err != nil || size == 0 {
+			return nil, errMalformedChunkSize
+		}
+		chunk := make([]byte, size)
+		if _, err = io.ReadFull(t.reader, chunk); err != nil {
+			return nil, err
+		}
+		message = append(message, chunk...)
+	}
+}
+
+// Close closes the underlying connection
+func (t *transport) Close() error {
+	return t.conn.Close()
+}
+
+// newSession exchanges hellos over the transport, unlike netconf.NewSession a hello that cannot be received (the agent
+// closed the connection, did not send it within the connect timeout or sent one that is malformed) is an error
+func newSession(t *transport) (*netconf.Session, error) {
+	hello, err := t.ReceiveHello()
+	if err != nil {
+		return nil, err
+	}
+	if err = t.SendHello(&netconf.HelloMessage{Capabilities: []string{base10Capability, base11Capability}}); err != nil {
+		return nil, err
+	}
+	for _, capability := range hello.Capabilities {
+		if capability == base11Capability {
+			t.chunked = true
+		}
+	}
+	return &netconf.Session{Transport: t, SessionID: hello.SessionID, ServerCapabilities: hello.Capabilities}, nil
+}
+
+// SendHello sends the clients hello message
+func (t *transport) SendHello(hello *netconf.HelloMessage) error {
+	val, err := xml.Marshal(hello)
+	if err != nil {
+		return err
+	}
+	return t.Send(append([]byte(xml.Header), val...))
+}
+
+// ReceiveHello receives the agents hello message
+func (t *transport) ReceiveHello() (*netconf.HelloMessage, error) {
+	hello := new(netconf.HelloMessage)
+	val, err := t.Receive()
+	if err != nil {
+		return hello, err
+	}
+	err = xml.Unmarshal(val, hello)
+	return hello, err
+}
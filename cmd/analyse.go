@@ -12,9 +12,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/damianoneill/nc-hammer/action"
 	"github.com/damianoneill/nc-hammer/result"
 	"github.com/damianoneill/nc-hammer/suite"
 	"github.com/olekukonko/tablewriter"
+	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/stat"
 
 	"github.com/spf13/cobra"
@@ -31,16 +33,21 @@ var AnalyseCmd = &cobra.Command{
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		if results, ts, err := result.UnarchiveResults(args[0]); err != nil {
+		results, ts, err := result.UnarchiveResults(args[0])
+		if err != nil {
 			log.Fatalf("Problem with loading result information: %v ", err)
-		} else {
-			AnalyseResults(cmd, ts, results)
 		}
+		run, err := result.UnarchiveRunInfo(args[0])
+		if err != nil {
+			log.Fatalf("Problem with loading run information: %v ", err)
+		}
+		AnalyseResults(cmd, ts, results, run)
 	},
 }
 
-// AnalyseResults Analyse the output of a Test Suite run
-func AnalyseResults(cmd *cobra.Command, ts *suite.TestSuite, results []result.NetconfResult) {
+// AnalyseResults Analyse the output of a Test Suite run, run information is optional as it is not available for
+// results archived by earlier versions
+func AnalyseResults(cmd *cobra.Command, ts *suite.TestSuite, results []result.NetconfResult, run *result.RunInfo) {
 
 	log.Println("")
 	log.Printf("Testsuite executed at %v\n", strings.Split(ts.File, string(filepath.Separator))[1])
@@ -50,8 +57,9 @@ func AnalyseResults(cmd *cobra.Command, ts *suite.TestSuite, results []result.Ne
 	}
 	log.Printf("Suite defined the following hosts: %v\n", hosts)
 
-	latencies := make(map[string]map[string][]float64)
+	latencies := make(map[string]map[OperationKey][]float64)
 	errCount := OrderAndExcludeErrValues(results, latencies)
+	corrected, showCorrected := CorrectedLatencies(results)
 
 	// get the largest when time from the results, this is the last action to run
 	var when float64
@@ -60,10 +68,32 @@ func AnalyseResults(cmd *cobra.Command, ts *suite.TestSuite, results []result.Ne
 			when = results[idx].When
 		}
 	}
-	executionTime := time.Duration(when) * time.Millisecond
+	executionTime := time.Duration(when * float64(time.Millisecond))
 
 	log.Printf("%d client(s) started, %d iterations per client, %d seconds wait between starting each client\n", ts.Clients, ts.Iterations, ts.Rampup)
+	if ts.Duration > 0 {
+		log.Printf("Run limited to a duration of %v\n", time.Duration(ts.Duration)*time.Second)
+	}
+	for idx, stage := range ts.Stages {
+		target := strconv.Itoa(stage.Clients) + " client(s)"
+		if ts.IsRateStages() {
+			target = fmt.Sprintf("%.2f per second", stage.Rate)
+		}
+		if stage.Ramp {
+			target = "ramping to " + target
+		}
+		log.Printf("Stage %v: %v for %d seconds\n", ts.StageLabel(idx+1), target, stage.Duration)
+	}
+	if run != nil {
+		log.Printf("Run stopped as the %v limit was reached, %d iterations completed\n", run.StopReason, run.Iterations)
+		if run.TargetRate > 0 {
+			log.Printf("Open model target rate %.2f %v(s) per second, achieved %.2f per second, %d arrivals using %d workers\n", run.TargetRate, run.RateUnit, run.AchievedRate, run.Arrivals, run.Workers)
+		}
+	}
 	log.Printf("\nTotal execution time: %v, Suite execution contained %v errors", executionTime, errCount)
+	if showCorrected {
+		log.Printf("Corrected latencies are measured from when requests were intended to be sent by the pacing or rate, including time queued behind slow requests\n")
+	}
 
 	log.Println("")
 
@@ -71,50 +101,401 @@ func AnalyseResults(cmd *cobra.Command, ts *suite.TestSuite, results []result.Ne
 	op, _ := cmd.Flags().GetString("operation")
 	//nolint
 	hostname, _ := cmd.Flags().GetString("hostname")
+	//nolint
+	flag, _ := cmd.Flags().GetString("percentiles")
+	percentiles, err := ParsePercentiles(flag)
+	if err != nil {
+		log.Fatalf("Problem with percentiles flag: %v ", err)
+	}
+
+	// throughput is measured over the runs wall clock time, or each stages duration
+	window := runWindow(results, run)
 
 	keys := SortLatencies(latencies) // returns sorted key index to latencies
+	showDatastore, showWithDefaults, showStage := qualifiedColumns(latencies)
+	showTransport := hasTLSTransport(ts.Configs)
+
+	// the unit is chosen from the latencies shown, so that an operation filtered out does not change it
+	var shown []float64
+	for host, operations := range latencies {
+		for key, values := range operations {
+			if (op == "" || op == key.Operation) && (hostname == "" || hostname == host) {
+				shown = append(shown, values...)
+				if showCorrected {
+					shown = append(shown, corrected[host][key]...)
+				}
+			}
+		}
+	}
+	unit, scale := latencyUnit(shown)
 
 	data := [][]string{}
 	for _, k := range keys {
 		host := k
 		operations := latencies[k]
-		for operation, latencies := range operations {
-			if op != "" && op != operation {
+		for _, key := range SortOperations(operations) {
+			latencies := operations[key]
+			if op != "" && op != key.Operation {
 				continue
 			}
 			if hostname != "" && hostname != host {
 				continue
 			}
+			histogram := latencyHistogram(latencies)
 			mean := stat.Mean(latencies, nil)
-			tps := 1000 / mean
+			tps := measuredTPS(len(latencies), stageWindow(ts, key.Stage, window))
 			variance := stat.Variance(latencies, nil)
 			stddev := math.Sqrt(variance)
-			data = append(data, []string{host, operation, strconv.FormatBool(ts.Configs.IsReuseConnection(host)), strconv.Itoa(len(latencies)), fmt.Sprintf("%.2f", tps), fmt.Sprintf("%.2f", mean), fmt.Sprintf("%.2f", variance), fmt.Sprintf("%.2f", stddev)})
+			row := []string{host, key.Operation}
+			if showDatastore {
+				row = append(row, key.Datastore)
+			}
+			if showWithDefaults {
+				row = append(row, key.WithDefaults)
+			}
+			if showStage {
+				row = append(row, ts.StageLabel(key.Stage))
+			}
+			if showTransport {
+				row = append(row, ts.Configs.Transport(host))
+			}
+			row = append(row, strconv.FormatBool(ts.Configs.IsReuseConnection(host)), strconv.Itoa(len(latencies)), fmt.Sprintf("%.2f", tps), fmt.Sprintf("%.2f", mean*scale), fmt.Sprintf("%.2f", variance*scale*scale), fmt.Sprintf("%.2f", stddev*scale),
+				fmt.Sprintf("%.2f", histogram.Min()*scale), fmt.Sprintf("%.2f", histogram.Max()*scale))
+			for _, p := range percentiles {
+				row = append(row, fmt.Sprintf("%.2f", histogram.Percentile(p)*scale))
+			}
+			if showCorrected {
+				// coordinated omission mostly distorts the tail, so the corrected percentiles are shown as well
+				correctedLatencies := corrected[host][key]
+				correctedHistogram := latencyHistogram(correctedLatencies)
+				row = append(row, fmt.Sprintf("%.2f", stat.Mean(correctedLatencies, nil)*scale), fmt.Sprintf("%.2f", correctedHistogram.Max()*scale))
+				for _, p := range percentiles {
+					row = append(row, fmt.Sprintf("%.2f", correctedHistogram.Percentile(p)*scale))
+				}
+			}
+			data = append(data, row)
+		}
+	}
+	header := []string{"Host", "Operation"}
+	if showDatastore {
+		header = append(header, "Datastore")
+	}
+	if showWithDefaults {
+		header = append(header, "With Defaults")
+	}
+	if showStage {
+		header = append(header, "Stage")
+	}
+	if showTransport {
+		header = append(header, "Transport")
+	}
+	header = append(header, "Reuse Connection", "Requests", "TPS", withUnit("Mean", unit), "Variance ("+unit+"²)", withUnit("Std Deviation", unit),
+		withUnit("Min", unit), withUnit("Max", unit))
+	for _, p := range percentiles {
+		header = append(header, withUnit(percentileLabel(p), unit))
+	}
+	if showCorrected {
+		header = append(header, withUnit("Corrected Mean", unit), withUnit("Corrected Max", unit))
+		for _, p := range percentiles {
+			header = append(header, withUnit("Corrected "+percentileLabel(p), unit))
 		}
 	}
 	var table = tablewriter.NewWriter(os.Stdout)
-	renderTable(table, []string{"Host", "Operation", "Reuse Connection", "Requests", "TPS", "Mean", "Variance", "Std Deviation"}, &data)
+	renderTable(table, header, &data)
 	table.Render()
+
+	if notifications, unit := AnalyseNotifications(results, hostname); len(notifications) > 0 {
+		log.Println("")
+		log.Printf("Notifications received on subscriptions, gaps are the time between consecutive notifications on a session and delay is the time from eventTime to receipt\n")
+		table = tablewriter.NewWriter(os.Stdout)
+		renderTable(table, []string{"Host", "Stream", "Notifications", withUnit("Mean Gap", unit), withUnit("Max Gap", unit), withUnit("Mean Delay", unit), withUnit("Max Delay", unit)}, &notifications)
+		table.Render()
+	}
+
+	if connections, unit := AnalyseConnections(results, ts.Configs, hostname); len(connections) > 0 {
+		log.Println("")
+		log.Printf("Connection setup per host, the time taken to establish each session, handshake includes authentication\n")
+		table = tablewriter.NewWriter(os.Stdout)
+		renderTable(table, []string{"Host", "Reuse Connection", "Sessions", withUnit("Mean Connect", unit), withUnit("Mean Handshake", unit), withUnit("Mean Hello", unit),
+			withUnit("Mean Setup", unit), withUnit("Max Setup", unit)}, &connections)
+		table.Render()
+	}
+}
+
+// units latencies are reported in
+const (
+	millisecondUnit = "ms"
+	microsecondUnit = "µs"
+)
+
+// latencyUnit returns the unit the latencies of a table are reported in and its scale from milliseconds. Microseconds
+// are used when all the latencies are under a millisecond, which would otherwise be reported as zero, so that a slow
+// operation in the same table is not reported in millions of microseconds
+func latencyUnit(latencies []float64) (string, float64) {
+	if len(latencies) == 0 {
+		return millisecondUnit, 1
+	}
+	for _, latency := range latencies {
+		if latency >= 1 {
+			return millisecondUnit, 1
+		}
+	}
+	return microsecondUnit, 1000
+}
+
+// withUnit returns the header of a latency column labelled with the unit it is reported in, for e.g. Mean (ms)
+func withUnit(header, unit string) string {
+	return header + " (" + unit + ")"
+}
+
+// ParsePercentiles parses a comma separated list of percentiles, for e.g. 50,99.9, each greater than 0 and at most 100
+func ParsePercentiles(percentiles string) ([]float64, error) {
+	var parsed []float64
+	for _, field := range strings.Split(percentiles, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(field, 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("percentile %v must be a number greater than 0 and at most 100", field)
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// runWindow returns the wall clock time of a run, falling back to the time the last result completed for results
+// archived without run information
+func runWindow(results []result.NetconfResult, run *result.RunInfo) time.Duration {
+	if run != nil {
+		return run.Completed.Sub(run.Started)
+	}
+	var when float64
+	for idx := range results {
+		if results[idx].When > when {
+			when = results[idx].When
+		}
+	}
+	return time.Duration(when * float64(time.Millisecond))
+}
+
+// stageWindow returns the window throughput is measured over, a stages duration for the results of a stage otherwise
+// the runs window
+func stageWindow(ts *suite.TestSuite, stage int, window time.Duration) time.Duration {
+	if stage > 0 && stage <= len(ts.Stages) {
+		return time.Duration(ts.Stages[stage-1].Duration) * time.Second
+	}
+	return window
+}
+
+// measuredTPS returns the requests completed per second over a window, zero for an empty window
+func measuredTPS(requests int, window time.Duration) float64 {
+	if window <= 0 {
+		return 0
+	}
+	return float64(requests) / window.Seconds()
+}
+
+// AnalyseConnections summarises the time taken to establish sessions per host, from the results that established a
+// new session. Returns a row per host, optionally filtered by host, or no rows for results archived without timings,
+// and the unit the times are reported in
+func AnalyseConnections(results []result.NetconfResult, configs suite.Configs, hostname string) ([][]string, string) {
+	connects := make(map[string][]float64)
+	handshakes := make(map[string][]float64)
+	hellos := make(map[string][]float64)
+	setups := make(map[string][]float64)
+	for idx := range results {
+		r := results[idx]
+		setup := r.Connect + r.Handshake + r.Hello
+		if setup == 0 || (hostname != "" && hostname != r.Hostname) {
+			continue
+		}
+		connects[r.Hostname] = append(connects[r.Hostname], r.Connect)
+		handshakes[r.Hostname] = append(handshakes[r.Hostname], r.Handshake)
+		hellos[r.Hostname] = append(hellos[r.Hostname], r.Hello)
+		setups[r.Hostname] = append(setups[r.Hostname], setup)
+	}
+
+	var hosts []string
+	var times []float64
+	for host := range setups {
+		hosts = append(hosts, host)
+		times = append(append(append(times, connects[host]...), handshakes[host]...), hellos[host]...)
+		times = append(times, setups[host]...)
+	}
+	sort.Strings(hosts)
+	unit, scale := latencyUnit(times)
+
+	data := [][]string{}
+	for _, host := range hosts {
+		data = append(data, []string{host, strconv.FormatBool(configs.IsReuseConnection(host)), strconv.Itoa(len(setups[host])),
+			fmt.Sprintf("%.2f", stat.Mean(connects[host], nil)*scale), fmt.Sprintf("%.2f", stat.Mean(handshakes[host], nil)*scale),
+			fmt.Sprintf("%.2f", stat.Mean(hellos[host], nil)*scale), fmt.Sprintf("%.2f", stat.Mean(setups[host], nil)*scale), fmt.Sprintf("%.2f", floats.Max(setups[host])*scale)})
+	}
+	return data, unit
+}
+
+// hasTLSTransport returns true if any of the hosts are connected to using TLS, the transport column is only displayed
+// when TLS is in use
+func hasTLSTransport(configs suite.Configs) bool {
+	for idx := range configs {
+		if configs[idx].Transport == suite.TransportTLS {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationKey identifies a row in the notification analysis
+type NotificationKey struct {
+	Hostname  string
+	Stream    string
+	Datastore string
+}
+
+// AnalyseNotifications summarises the notifications received per host and stream, the count, inter-arrival gaps and
+// eventTime to receipt delays. Returns a row per host and stream, optionally filtered by host, and the unit the times
+// are reported in
+func AnalyseNotifications(results []result.NetconfResult, hostname string) ([][]string, string) {
+	delays := make(map[NotificationKey][]float64)
+	arrivals := make(map[NotificationKey]map[string][]float64) // when values per session
+	for idx := range results {
+		r := results[idx]
+		if r.Operation != action.NotificationOperation || r.Err != "" || (hostname != "" && hostname != r.Hostname) {
+			continue
+		}
+		key := NotificationKey{Hostname: r.Hostname, Stream: r.Stream, Datastore: r.Datastore}
+		delays[key] = append(delays[key], r.Latency)
+		if arrivals[key] == nil {
+			arrivals[key] = make(map[string][]float64)
+		}
+		session := strconv.Itoa(r.Client) + ":" + strconv.Itoa(r.SessionID)
+		arrivals[key][session] = append(arrivals[key][session], r.When)
+	}
+
+	var keys []NotificationKey
+	for k := range delays {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Hostname != keys[j].Hostname {
+			return keys[i].Hostname < keys[j].Hostname
+		}
+		if keys[i].Stream != keys[j].Stream {
+			return keys[i].Stream < keys[j].Stream
+		}
+		return keys[i].Datastore < keys[j].Datastore
+	})
+
+	gaps := make(map[NotificationKey][]float64)
+	var times []float64
+	for _, key := range keys {
+		for _, when := range arrivals[key] {
+			sort.Float64s(when)
+			for i := 1; i < len(when); i++ {
+				gaps[key] = append(gaps[key], when[i]-when[i-1])
+			}
+		}
+		times = append(append(times, gaps[key]...), delays[key]...)
+	}
+	unit, scale := latencyUnit(times)
+
+	data := [][]string{}
+	for _, key := range keys {
+		gaps := gaps[key]
+		stream := key.Stream
+		if key.Datastore != "" {
+			stream += " (" + key.Datastore + ")"
+		}
+		meanGap, maxGap := "-", "-"
+		if len(gaps) > 0 {
+			meanGap, maxGap = fmt.Sprintf("%.2f", stat.Mean(gaps, nil)*scale), fmt.Sprintf("%.2f", floats.Max(gaps)*scale)
+		}
+		data = append(data, []string{key.Hostname, stream, strconv.Itoa(len(delays[key])), meanGap, maxGap, fmt.Sprintf("%.2f", stat.Mean(delays[key], nil)*scale), fmt.Sprintf("%.2f", floats.Max(delays[key])*scale)})
+	}
+	return data, unit
+}
+
+// OperationKey identifies a row in the analysis, an operation qualified by the datastore it was sent against, the
+// with-defaults reporting mode it requested and the stage of the load profile it completed in
+type OperationKey struct {
+	Operation    string
+	Datastore    string
+	WithDefaults string
+	Stage        int
+}
+
+// qualifiedColumns returns whether any of the operations were qualified by a datastore, with-defaults mode or stage,
+// these columns are only displayed when relevant
+func qualifiedColumns(latencies map[string]map[OperationKey][]float64) (datastore, withDefaults, stage bool) {
+	for _, operations := range latencies {
+		for key := range operations {
+			datastore = datastore || key.Datastore != ""
+			withDefaults = withDefaults || key.WithDefaults != ""
+			stage = stage || key.Stage != 0
+		}
+	}
+	return datastore, withDefaults, stage
 }
 
 // OrderAndExcludeErrValues Orders the results and removes errors from output. Returns number of errors found.
-func OrderAndExcludeErrValues(results []result.NetconfResult, latencies map[string]map[string][]float64) int {
+func OrderAndExcludeErrValues(results []result.NetconfResult, latencies map[string]map[OperationKey][]float64) int {
 	var errCount int
 	for idx := range results {
 		if latencies[results[idx].Hostname] == nil {
-			latencies[results[idx].Hostname] = make(map[string][]float64)
+			latencies[results[idx].Hostname] = make(map[OperationKey][]float64)
 		}
-		// only add latency if its not in error
+		// only add latency if its not in error, notifications are analysed separately
 		if results[idx].Err != "" {
 			errCount++
-		} else {
-			latencies[results[idx].Hostname][results[idx].Operation] = append(latencies[results[idx].Hostname][results[idx].Operation], results[idx].Latency)
+		} else if results[idx].Operation != action.NotificationOperation {
+			key := operationKey(&results[idx])
+			latencies[results[idx].Hostname][key] = append(latencies[results[idx].Hostname][key], results[idx].Latency)
 		}
 	}
 
 	return errCount
 }
 
+// CorrectedLatencies returns the latencies of the successful requests corrected for coordinated omission, measured
+// from when each request was intended to be sent rather than when it was sent. Requests without an intended send
+// time, those not paced or scheduled at a rate, are not corrected. Also returns whether any request was corrected
+func CorrectedLatencies(results []result.NetconfResult) (map[string]map[OperationKey][]float64, bool) {
+	corrected := make(map[string]map[OperationKey][]float64)
+	var found bool
+	for idx := range results {
+		r := &results[idx]
+		if r.Err != "" || r.Operation == action.NotificationOperation {
+			continue
+		}
+		if corrected[r.Hostname] == nil {
+			corrected[r.Hostname] = make(map[OperationKey][]float64)
+		}
+		latency := r.Latency
+		if r.Intended > 0 {
+			latency += r.Sent - r.Intended
+			found = true
+		}
+		key := operationKey(r)
+		corrected[r.Hostname][key] = append(corrected[r.Hostname][key], latency)
+	}
+	return corrected, found
+}
+
+// latencyHistogram returns a histogram of latencies
+func latencyHistogram(latencies []float64) *result.Histogram {
+	histogram := result.NewHistogram()
+	for _, latency := range latencies {
+		histogram.Record(latency)
+	}
+	return histogram
+}
+
+func operationKey(r *result.NetconfResult) OperationKey {
+	return OperationKey{Operation: r.Operation, Datastore: r.Datastore, WithDefaults: r.WithDefaults, Stage: r.Stage}
+}
+
 // SortResults Sorts its contents by hostname or operation if duplicate hostnames exist
 func SortResults(results []result.NetconfResult) {
 	sort.Slice(results, func(i, j int) bool {
@@ -126,7 +507,17 @@ func SortResults(results []result.NetconfResult) {
 }
 
 func renderTable(table *tablewriter.Table, header []string, data *[][]string) {
-	table.SetHeader(header)
+	// headers are upper cased here rather than by the table, so that the units of latency columns keep their case, the
+	// micro sign of µs would otherwise become a Greek capital M and read as ms
+	titles := make([]string, len(header))
+	for idx := range header {
+		titles[idx] = strings.ToUpper(header[idx])
+		for _, unit := range []string{millisecondUnit, microsecondUnit} {
+			titles[idx] = strings.Replace(titles[idx], "("+strings.ToUpper(unit), "("+unit, 1)
+		}
+	}
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader(titles)
 	table.SetRowLine(true)
 
 	table.SetCenterSeparator("")
@@ -139,12 +530,13 @@ func renderTable(table *tablewriter.Table, header []string, data *[][]string) {
 
 func init() {
 	RootCmd.AddCommand(AnalyseCmd)
-	AnalyseCmd.Flags().StringP("operation", "o", "", "filter based on operation type; get, get-config or edit-config")
+	AnalyseCmd.Flags().StringP("operation", "o", "", "filter based on operation type; for e.g. get, get-config, edit-config or commit")
 	AnalyseCmd.Flags().StringP("hostname", "", "", "filter based on host name or ip")
+	AnalyseCmd.Flags().StringP("percentiles", "", "50,90,95,99,99.9", "latency percentiles shown as columns, a comma separated list; for e.g. 50,99 or empty for none")
 }
 
 // SortLatencies Sorts keys of latencies Map to allow for ordered iteration of map
-func SortLatencies(latencies map[string]map[string][]float64) []string {
+func SortLatencies(latencies map[string]map[OperationKey][]float64) []string {
 	var keys []string
 	for k := range latencies {
 		keys = append(keys, k)
@@ -153,3 +545,30 @@ func SortLatencies(latencies map[string]map[string][]float64) []string {
 
 	return keys
 }
+
+// SortOperations Sorts keys of a hosts operations Map by operation, datastore, with-defaults mode and then stage
+func SortOperations(operations map[OperationKey][]float64) []OperationKey {
+	var keys []OperationKey
+	for k := range operations {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return operationKeyLess(keys[i], keys[j])
+	})
+
+	return keys
+}
+
+// operationKeyLess orders operation keys by operation, datastore, with-defaults mode and stage
+func operationKeyLess(a, b OperationKey) bool {
+	if a.Operation != b.Operation {
+		return a.Operation < b.Operation
+	}
+	if a.Datastore != b.Datastore {
+		return a.Datastore < b.Datastore
+	}
+	if a.WithDefaults != b.WithDefaults {
+		return a.WithDefaults < b.WithDefaults
+	}
+	return a.Stage < b.Stage
+}
@@ -2,11 +2,17 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/damianoneill/nc-hammer/action"
 	"github.com/damianoneill/nc-hammer/result"
 	"github.com/damianoneill/nc-hammer/suite"
 	"github.com/olekukonko/tablewriter"
@@ -33,28 +39,236 @@ var analyseErrorCmd = &cobra.Command{
 }
 
 func analyseErrors(cmd *cobra.Command, ts *suite.TestSuite, results []result.NetconfResult) {
+	//nolint
+	verbose, _ := cmd.Flags().GetBool("verbose")
 	log.Println("")
 	log.Printf("Testsuite executed at %v\n", strings.Split(ts.File, string(filepath.Separator))[1])
 
-	SortResults(results)
+	groups := GroupErrors(results)
+	total := 0
+	for _, group := range groups {
+		total += group.Count
+	}
+	log.Printf("Total Number of Errors for suite: %d\n", total)
+
+	var table = tablewriter.NewWriter(os.Stdout)
+	table.SetReflowDuringAutoWrap(true)
+	table.SetColWidth(80)
+	var header []string
+	var errors [][]string
+	if verbose {
+		header, errors = errorGroupsTable(groups)
+	} else {
+		header, errors = errorSummaryTable(SummariseErrors(results))
+	}
+	renderTable(table, header, &errors)
+
+	table.Render()
+}
+
+// errorGroupsTable returns the header and data of the errors grouped by host, operation and error, the rpc-error
+// columns are only shown when an agent returned an rpc-error
+func errorGroupsTable(groups []ErrorGroup) ([]string, [][]string) {
+	rpcErrors := false
+	for _, group := range groups {
+		rpcErrors = rpcErrors || group.Tag != ""
+	}
+	header := []string{"Hostname", "Operation", "Category"}
+	if rpcErrors {
+		header = append(header, "Type", "Tag", "Severity", "App Tag", "Path")
+	}
+	header = append(header, "Error", "Count")
+	var errors [][]string
+	for _, group := range groups {
+		line := []string{group.Hostname, group.Operation, group.Category}
+		if rpcErrors {
+			line = append(line, group.Type, group.Tag, group.Severity, group.AppTag, group.Path)
+		}
+		errors = append(errors, append(line, group.Error, strconv.Itoa(group.Count)))
+	}
+	return header, errors
+}
+
+// maxSummaryHosts is the number of hosts listed against a category in the summary, the number of the others is given
+const maxSummaryHosts = 5
 
+// errorSummaryTable returns the header and data of the error summary, when is shown as the time since the start of
+// the run
+func errorSummaryTable(summaries []ErrorSummary) ([]string, [][]string) {
+	when := func(ms float64) string {
+		return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond).String()
+	}
 	var errors [][]string
+	for _, summary := range summaries {
+		hosts := summary.Hosts
+		if len(hosts) > maxSummaryHosts {
+			hosts = append(hosts[:maxSummaryHosts:maxSummaryHosts], fmt.Sprintf("and %d more", len(summary.Hosts)-maxSummaryHosts))
+		}
+		errors = append(errors, []string{summary.Category, strconv.Itoa(summary.Count), when(summary.First), when(summary.Last), strings.Join(hosts, ", ")})
+	}
+	return []string{"Category", "Count", "First", "Last", "Hosts"}, errors
+}
+
+// ErrorSummary counts the errors of a category, First and Last are when the first and last of them occurred in
+// milliseconds since the start of the run
+type ErrorSummary struct {
+	Category string
+	Count    int
+	First    float64
+	Last     float64
+	Hosts    []string
+}
+
+// SummariseErrors summarises the errors of a run by category, the categories are ordered from the most to the least
+// errors and the hosts of each are sorted
+func SummariseErrors(results []result.NetconfResult) []ErrorSummary {
+	index := make(map[string]int)
+	hosts := make(map[string]map[string]bool)
+	var summaries []ErrorSummary
 	for idx := range results {
-		if results[idx].Err != "" {
-			errors = append(errors, []string{results[idx].Hostname, results[idx].Operation, results[idx].MessageID, results[idx].Err})
+		r := &results[idx]
+		if r.Err == "" {
+			continue
+		}
+		category := ErrorCategory(r)
+		i, present := index[category]
+		if !present {
+			i = len(summaries)
+			index[category] = i
+			hosts[category] = make(map[string]bool)
+			summaries = append(summaries, ErrorSummary{Category: category, First: r.When, Last: r.When})
+		}
+		summary := &summaries[i]
+		summary.Count++
+		summary.First = math.Min(summary.First, r.When)
+		summary.Last = math.Max(summary.Last, r.When)
+		if !hosts[category][r.Hostname] {
+			hosts[category][r.Hostname] = true
+			summary.Hosts = append(summary.Hosts, r.Hostname)
 		}
 	}
+	for idx := range summaries {
+		sort.Strings(summaries[idx].Hosts)
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if summaries[i].Count != summaries[j].Count {
+			return summaries[i].Count > summaries[j].Count
+		}
+		return summaries[i].Category < summaries[j].Category
+	})
+	return summaries
+}
 
-	log.Printf("Total Number of Errors for suite: %d\n", len(errors))
+// ErrorGroup counts the errors of an operation on a host with the same rpc-error tag and path, or the same error when
+// the agent did not return an rpc-error. The type, severity, app tag and error are those of the first error counted,
+// the error being the rpc-errors message if it has one
+type ErrorGroup struct {
+	Hostname  string
+	Operation string
+	Category  string
+	Type      string
+	Tag       string
+	Severity  string
+	AppTag    string
+	Path      string
+	Error     string
+	Count     int
+}
 
-	var table = tablewriter.NewWriter(os.Stdout)
-	table.SetReflowDuringAutoWrap(true)
-	table.SetColWidth(80)
-	renderTable(table, []string{"Hostname", "Operation", "Message ID", "Error"}, &errors)
+// GroupErrors groups the errors of a run, the groups are ordered from the most to the least errors
+func GroupErrors(results []result.NetconfResult) []ErrorGroup {
+	type groupKey struct {
+		hostname  string
+		operation string
+		tag       string
+		path      string
+		err       string
+	}
+	index := make(map[groupKey]int)
+	var groups []ErrorGroup
+	for idx := range results {
+		r := &results[idx]
+		if r.Err == "" {
+			continue
+		}
+		key := groupKey{hostname: r.Hostname, operation: r.Operation, tag: r.ErrorTag, path: r.ErrorPath}
+		if r.ErrorTag == "" {
+			key.err = r.Err
+		}
+		if i, present := index[key]; present {
+			groups[i].Count++
+			continue
+		}
+		group := ErrorGroup{Hostname: r.Hostname, Operation: r.Operation, Category: ErrorCategory(r), Type: r.ErrorType, Tag: r.ErrorTag,
+			Severity: r.ErrorSeverity, AppTag: r.ErrorAppTag, Path: r.ErrorPath, Error: r.Err, Count: 1}
+		if r.ErrorMessage != "" {
+			group.Error = r.ErrorMessage
+		}
+		index[key] = len(groups)
+		groups = append(groups, group)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		if groups[i].Hostname != groups[j].Hostname {
+			return groups[i].Hostname < groups[j].Hostname
+		}
+		return groups[i].Operation < groups[j].Operation
+	})
+	return groups
+}
 
-	table.Render()
+// Error categories reported by analyse error, rpc-errors are categorised by their tag
+const (
+	CategoryHostKey           = "Host Key Verification"
+	CategoryConnectionRefused = "Connection Refused"
+	CategoryAuthentication    = "Authentication Failure"
+	CategorySessionClosed     = "Session Closed"
+	CategoryTimeout           = "Timeout"
+	CategoryRPCError          = "RPC Error"
+	CategoryExpectedMismatch  = "Expected Mismatch"
+	CategoryInvalidExpected   = "Invalid Expected"
+	CategoryAssertion         = "Assertion Failed"
+	CategoryXMLRender         = "XML Render Error"
+	CategoryOther             = "Other"
+)
+
+// ErrorCategory classifies the error recorded against a result, host key verification failures are reported
+// separately as they indicate a possible man in the middle rather than a problem with the agent. Results archived
+// before rpc-errors were parsed are categorised as rpc-errors without a tag
+func ErrorCategory(r *result.NetconfResult) string {
+	err := r.Err
+	switch {
+	case strings.HasPrefix(err, action.HostKeyVerificationFailed):
+		return CategoryHostKey
+	case r.ErrorTag != "":
+		return CategoryRPCError + " (" + r.ErrorTag + ")"
+	case strings.HasPrefix(err, "netconf rpc ["):
+		return CategoryRPCError
+	case err == action.SessionClosed:
+		return CategorySessionClosed
+	case strings.HasPrefix(err, action.ExpectedMismatch):
+		return CategoryExpectedMismatch
+	case strings.HasPrefix(err, action.InvalidExpected):
+		return CategoryInvalidExpected
+	case strings.HasPrefix(err, action.AssertionFailed):
+		return CategoryAssertion
+	case strings.HasPrefix(err, action.XMLRenderFailed):
+		return CategoryXMLRender
+	case strings.HasPrefix(err, action.ConnectTimedOut):
+		return CategoryTimeout
+	case strings.Contains(err, "unable to authenticate"):
+		return CategoryAuthentication
+	case strings.Contains(err, "connection refused"):
+		return CategoryConnectionRefused
+	case strings.HasSuffix(err, "i/o timeout"):
+		return CategoryTimeout
+	}
+	return CategoryOther
 }
 
 func init() {
 	AnalyseCmd.AddCommand(analyseErrorCmd)
+	analyseErrorCmd.Flags().BoolP("verbose", "v", false, "list the errors of each host and operation rather than a summary of each category")
 }
@@ -12,6 +12,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/damianoneill/nc-hammer/action"
 	"github.com/damianoneill/nc-hammer/result"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
@@ -93,10 +94,10 @@ func Test_AnalyseErrorCmdRun(t *testing.T) {
 }
 func Test_analyseErrors(t *testing.T) {
 	expectedResults := [][]string{
-		{"172.26.138.91", "kill-session", "kill-session is not a supported operation"},
-		{"172.26.138.92", "delete-config", "delete-config is not a supported operation"},
-		{"172.26.138.93", "kill-session", "kill-session is not a supported operation"},
-		{"172.26.138.94", "delete-config", "delete-config is not a supported operation"},
+		{"172.26.138.91", "kill-session", "Other", "kill-session is not a supported operation"},
+		{"172.26.138.92", "delete-config", "Other", "delete-config is not a supported operation"},
+		{"172.26.138.93", "kill-session", "Other", "kill-session is not a supported operation"},
+		{"172.26.138.94", "delete-config", "Other", "delete-config is not a supported operation"},
 	}
 
 	results, ts, err := result.UnarchiveResults("../suite/testdata/results_test/2018-07-18-19-56-01/")
@@ -109,32 +110,104 @@ func Test_analyseErrors(t *testing.T) {
 			errors = append(errors, []string{results[i].Hostname, results[i].Operation, results[i].Err})
 		}
 	}
-	var buff bytes.Buffer
-	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
-	log.SetOutput(&buff)
+	got := func(verbose bool) (string, string) {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("verbose", verbose, "")
+		return CaptureStdout(func(cmd *cobra.Command, args []string) { analyseErrors(cmd, ts, results) }, cmd, nil)
+	}
+	errLen := strconv.Itoa(len(errors))
+	want := strings.TrimSpace("Testsuite executed at " + strings.Split(ts.File, string(filepath.Separator))[1] +
+		"\n" + "Total Number of Errors for suite: " + errLen)
 
-	//reading from stdout
-	rescueStdout := os.Stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
-	analyseErrors(myCmd, ts, results)
+	t.Run("summary of each category", func(t *testing.T) {
+		have, logged := got(false)
+		assert.Contains(t, have, "CATEGORY COUNT FIRST LAST HOSTS")
+		assert.Contains(t, have, "Other "+errLen)
+		assert.Equal(t, want, logged)
+	})
+	t.Run("verbose lists the errors of each host and operation", func(t *testing.T) {
+		have, logged := got(true)
+		assert.Contains(t, have, "HOSTNAME OPERATION CATEGORY ERROR COUNT")
+		for _, expectedError := range expectedResults {
+			errorsTostring := strings.Join(expectedError, " ")
+			assert.Contains(t, have, errorsTostring) // check errors are printed to stdout
+		}
+		assert.Equal(t, want, logged)
+	})
+}
 
-	w.Close()
-	out, _ := ioutil.ReadAll(r)
-	os.Stdout = rescueStdout
-	have := strings.Join(strings.Fields(string(out)), " ") // stdout captured and trim spaces
+func TestGroupErrors(t *testing.T) {
+	results := []result.NetconfResult{
+		{Hostname: "10.0.0.1", Operation: "edit-config", Latency: 10},
+		{Hostname: "10.0.0.1", Operation: "edit-config", Err: "netconf rpc [error] 'in use'", ErrorType: "protocol", ErrorTag: "in-use", ErrorSeverity: "error", ErrorMessage: "in use"},
+		{Hostname: "10.0.0.1", Operation: "edit-config", Err: "netconf rpc [error] 'eth9'", ErrorType: "application", ErrorTag: "invalid-value", ErrorSeverity: "error",
+			ErrorAppTag: "not-found", ErrorPath: "/interfaces/interface[name='eth9']", ErrorMessage: "eth9"},
+		{Hostname: "10.0.0.1", Operation: "edit-config", Err: "netconf rpc [error] 'eth9 again'", ErrorType: "application", ErrorTag: "invalid-value", ErrorSeverity: "error",
+			ErrorPath: "/interfaces/interface[name='eth9']", ErrorMessage: "eth9 again"},
+		{Hostname: "10.0.0.1", Operation: "edit-config", Err: "netconf rpc [error] 'eth8'", ErrorType: "application", ErrorTag: "invalid-value", ErrorSeverity: "error",
+			ErrorPath: "/interfaces/interface[name='eth8']", ErrorMessage: "eth8"},
+		{Hostname: "10.0.0.1", Operation: "get", Err: "session closed by remote side"},
+		{Hostname: "10.0.0.2", Operation: "get", Err: "session closed by remote side"},
+		{Hostname: "10.0.0.2", Operation: "get", Err: "session closed by remote side"},
+	}
+	assert.Equal(t, []ErrorGroup{
+		{Hostname: "10.0.0.1", Operation: "edit-config", Category: CategoryRPCError + " (invalid-value)", Type: "application", Tag: "invalid-value", Severity: "error", AppTag: "not-found",
+			Path: "/interfaces/interface[name='eth9']", Error: "eth9", Count: 2},
+		{Hostname: "10.0.0.2", Operation: "get", Category: CategorySessionClosed, Error: "session closed by remote side", Count: 2},
+		{Hostname: "10.0.0.1", Operation: "edit-config", Category: CategoryRPCError + " (in-use)", Type: "protocol", Tag: "in-use", Severity: "error", Error: "in use", Count: 1},
+		{Hostname: "10.0.0.1", Operation: "edit-config", Category: CategoryRPCError + " (invalid-value)", Type: "application", Tag: "invalid-value", Severity: "error",
+			Path: "/interfaces/interface[name='eth8']", Error: "eth8", Count: 1},
+		{Hostname: "10.0.0.1", Operation: "get", Category: CategorySessionClosed, Error: "session closed by remote side", Count: 1},
+	}, GroupErrors(results))
+}
 
-	assert.Contains(t, have, "HOSTNAME OPERATION MESSAGE ID ERROR")
-	for _, expectedError := range expectedResults {
-		errorsTostring := strings.Join(expectedError, " ")
-		assert.Contains(t, have, errorsTostring) // check errors are printed to stdout
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		name   string
+		result result.NetconfResult
+		want   string
+	}{
+		{"host key", result.NetconfResult{Err: action.HostKeyVerificationFailed + ": 10.0.0.1:830 is not in known_hosts, key SHA256:abc"}, CategoryHostKey},
+		{"rpc-error", result.NetconfResult{Err: "netconf rpc [error] 'in use'", ErrorTag: "in-use"}, CategoryRPCError + " (in-use)"},
+		{"archived rpc-error", result.NetconfResult{Err: "netconf rpc [error] 'in use'"}, CategoryRPCError},
+		{"session closed", result.NetconfResult{Err: action.SessionClosed}, CategorySessionClosed},
+		{"expected mismatch", result.NetconfResult{Err: action.ExpectedMismatch + ", got '<data/>'"}, CategoryExpectedMismatch},
+		{"invalid expected", result.NetconfResult{Err: action.InvalidExpected + ": error parsing regexp: missing closing ]: `[a`"}, CategoryInvalidExpected},
+		{"assertion", result.NetconfResult{Err: action.AssertionFailed + ": //mtu selected 2 elements, expected 1"}, CategoryAssertion},
+		{"xml render", result.NetconfResult{Err: action.XMLRenderFailed + ": xml: unsupported type"}, CategoryXMLRender},
+		{"authentication", result.NetconfResult{Err: "ssh: handshake failed: ssh: unable to authenticate, attempted methods [none password]"}, CategoryAuthentication},
+		{"connection refused", result.NetconfResult{Err: "dial tcp 10.0.0.1:830: connect: connection refused"}, CategoryConnectionRefused},
+		{"timeout", result.NetconfResult{Err: "dial tcp 10.0.0.1:830: i/o timeout"}, CategoryTimeout},
+		{"connect timed out", result.NetconfResult{Err: action.ConnectTimedOut + ": ssh: handshake failed: read tcp 127.0.0.1:50412->127.0.0.1:830: i/o timeout"}, CategoryTimeout},
+		{"timed out by the agent", result.NetconfResult{Err: "netconf rpc [error] 'lock timed out'"}, CategoryRPCError},
+		{"timeout in a message", result.NetconfResult{Err: "session-timeout is not a valid parameter"}, CategoryOther},
+		{"other", result.NetconfResult{Err: "kill-session is not a supported operation"}, CategoryOther},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ErrorCategory(&tt.result))
+		})
+	}
+}
 
-	got := strings.TrimSpace(buff.String())
-	errLen := strconv.Itoa(len(errors))
-	want := strings.TrimSpace("Testsuite executed at " + strings.Split(ts.File, string(filepath.Separator))[1] +
-		"\n" + "Total Number of Errors for suite: " + errLen)
-	if got != want {
-		t.Errorf("wanted, '%s', but got '%s'", want, got)
+func TestSummariseErrors(t *testing.T) {
+	results := []result.NetconfResult{
+		{Hostname: "10.0.0.2", When: 300, Err: action.SessionClosed},
+		{Hostname: "10.0.0.1", When: 100, Latency: 10},
+		{Hostname: "10.0.0.1", When: 200, Err: action.SessionClosed},
+		{Hostname: "10.0.0.2", When: 50, Err: "dial tcp 10.0.0.2:830: i/o timeout"},
+		{Hostname: "10.0.0.2", When: 100, Err: action.SessionClosed},
 	}
+	summaries := SummariseErrors(results)
+	assert.Equal(t, []ErrorSummary{
+		{Category: CategorySessionClosed, Count: 3, First: 100, Last: 300, Hosts: []string{"10.0.0.1", "10.0.0.2"}},
+		{Category: CategoryTimeout, Count: 1, First: 50, Last: 50, Hosts: []string{"10.0.0.2"}},
+	}, summaries)
+
+	_, rows := errorSummaryTable(summaries)
+	assert.Equal(t, []string{CategorySessionClosed, "3", "100ms", "300ms", "10.0.0.1, 10.0.0.2"}, rows[0])
+	summaries[0].Hosts = []string{"h1", "h2", "h3", "h4", "h5", "h6", "h7"}
+	_, rows = errorSummaryTable(summaries)
+	assert.Equal(t, "h1, h2, h3, h4, h5, and 2 more", rows[0][4])
+	assert.Equal(t, 7, len(summaries[0].Hosts))
 }
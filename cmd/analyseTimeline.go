@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/action"
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// Output formats supported by analyse timeline
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+)
+
+// analyseTimelineCmd represents the analyse timeline command
+var analyseTimelineCmd = &cobra.Command{
+	Use:   "timeline <results file>",
+	Short: "Analyse the throughput, errors and latency of a Test Suite run over time",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("timeline command requires a test results directory as an argument")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if results, ts, err := result.UnarchiveResults(args[0]); err != nil {
+			log.Fatalf("Problem with loading result information: %v ", err)
+		} else {
+			analyseTimeline(cmd, ts, results)
+		}
+	},
+}
+
+// TimelineRow summarises the requests to a host for an operation that completed in an interval of a run, operations
+// are qualified by datastore, with-defaults mode and stage as they are in analyse. Latencies are in milliseconds and
+// are of the successful requests only, omitted when there were none
+type TimelineRow struct {
+	Start        float64            `json:"start"` // seconds since the start of the run
+	Hostname     string             `json:"hostname"`
+	Operation    string             `json:"operation"`
+	Datastore    string             `json:"datastore,omitempty"`
+	WithDefaults string             `json:"withDefaults,omitempty"`
+	Stage        int                `json:"stage,omitempty"`
+	Requests     int                `json:"requests"`
+	Errors       int                `json:"errors"`
+	TPS          float64            `json:"tps"`
+	ErrorRate    float64            `json:"errorRate"` // percentage of requests
+	Mean         float64            `json:"mean,omitempty"`
+	Percentiles  map[string]float64 `json:"percentiles,omitempty"`
+}
+
+func analyseTimeline(cmd *cobra.Command, ts *suite.TestSuite, results []result.NetconfResult) {
+	//nolint
+	interval, _ := cmd.Flags().GetDuration("interval")
+	//nolint
+	format, _ := cmd.Flags().GetString("format")
+	//nolint
+	flag, _ := cmd.Flags().GetString("percentiles")
+	//nolint
+	op, _ := cmd.Flags().GetString("operation")
+	//nolint
+	hostname, _ := cmd.Flags().GetString("hostname")
+	if interval <= 0 {
+		log.Fatalf("Problem with interval flag: interval must be greater than zero ")
+	}
+	if format != FormatTable && format != FormatCSV && format != FormatJSON {
+		log.Fatalf("Problem with format flag: format must be %v, %v or %v ", FormatTable, FormatCSV, FormatJSON)
+	}
+	percentiles, err := ParsePercentiles(flag)
+	if err != nil {
+		log.Fatalf("Problem with percentiles flag: %v ", err)
+	}
+
+	log.Println("")
+	log.Printf("Testsuite executed at %v\n", strings.Split(ts.File, string(filepath.Separator))[1])
+	log.Printf("Requests grouped by the %v interval they completed in\n", interval)
+
+	rows := Timeline(results, interval, percentiles, op, hostname)
+	switch format {
+	case FormatCSV:
+		err = writeTimelineCSV(os.Stdout, rows, percentiles)
+	case FormatJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(rows)
+	default:
+		header, data := timelineTable(ts, rows, percentiles)
+		var table = tablewriter.NewWriter(os.Stdout)
+		renderTable(table, header, &data)
+		table.Render()
+	}
+	if err != nil {
+		log.Fatalf("Problem with writing the timeline: %v ", err)
+	}
+}
+
+// Timeline groups the requests, optionally filtered by operation and host, by the interval they completed in. There
+// is a row for each interval from the start of the run to the last request for each host and operation, so that an
+// interval without any requests completing is visible. Notifications are not requests and are not included
+func Timeline(results []result.NetconfResult, interval time.Duration, percentiles []float64, op, hostname string) []TimelineRow {
+	type timelineKey struct {
+		hostname string
+		OperationKey
+	}
+	requests := make(map[timelineKey]map[int][]result.NetconfResult)
+	last := 0
+	for idx := range results {
+		r := results[idx]
+		if r.Operation == action.NotificationOperation || (op != "" && op != r.Operation) || (hostname != "" && hostname != r.Hostname) {
+			continue
+		}
+		key := timelineKey{hostname: r.Hostname, OperationKey: operationKey(&r)}
+		if requests[key] == nil {
+			requests[key] = make(map[int][]result.NetconfResult)
+		}
+		bucket := int(r.When * float64(time.Millisecond) / float64(interval))
+		requests[key][bucket] = append(requests[key][bucket], r)
+		if bucket > last {
+			last = bucket
+		}
+	}
+
+	var keys []timelineKey
+	for key := range requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].hostname != keys[j].hostname {
+			return keys[i].hostname < keys[j].hostname
+		}
+		return operationKeyLess(keys[i].OperationKey, keys[j].OperationKey)
+	})
+
+	var rows []TimelineRow
+	for bucket := 0; bucket <= last && len(keys) > 0; bucket++ {
+		for _, key := range keys {
+			row := TimelineRow{Start: (time.Duration(bucket) * interval).Seconds(), Hostname: key.hostname, Operation: key.Operation,
+				Datastore: key.Datastore, WithDefaults: key.WithDefaults, Stage: key.Stage}
+			histogram := result.NewHistogram()
+			for _, r := range requests[key][bucket] {
+				row.Requests++
+				if r.Err != "" {
+					row.Errors++
+					continue
+				}
+				histogram.Record(r.Latency)
+			}
+			row.TPS = float64(row.Requests) / interval.Seconds()
+			if row.Requests > 0 {
+				row.ErrorRate = float64(row.Errors) * 100 / float64(row.Requests)
+			}
+			if histogram.Count() > 0 {
+				row.Mean = histogram.Mean()
+				row.Percentiles = make(map[string]float64)
+				for _, p := range percentiles {
+					row.Percentiles[percentileLabel(p)] = histogram.Percentile(p)
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// timelineTable returns the header and data of the timeline as a table, latencies are scaled to the unit chosen for
+// the latencies shown. The datastore, with-defaults and stage columns are only included when relevant, as in analyse
+func timelineTable(ts *suite.TestSuite, rows []TimelineRow, percentiles []float64) ([]string, [][]string) {
+	var showDatastore, showWithDefaults, showStage bool
+	var shown []float64
+	for _, row := range rows {
+		showDatastore = showDatastore || row.Datastore != ""
+		showWithDefaults = showWithDefaults || row.WithDefaults != ""
+		showStage = showStage || row.Stage != 0
+		if row.Requests > row.Errors {
+			shown = append(shown, row.Mean)
+			for _, p := range percentiles {
+				shown = append(shown, row.Percentiles[percentileLabel(p)])
+			}
+		}
+	}
+	unit, scale := latencyUnit(shown)
+	header := []string{"Start", "Host", "Operation"}
+	if showDatastore {
+		header = append(header, "Datastore")
+	}
+	if showWithDefaults {
+		header = append(header, "With Defaults")
+	}
+	if showStage {
+		header = append(header, "Stage")
+	}
+	header = append(header, "Requests", "Errors", "TPS", "Error %", withUnit("Mean", unit))
+	for _, p := range percentiles {
+		header = append(header, withUnit(percentileLabel(p), unit))
+	}
+	data := [][]string{}
+	for _, row := range rows {
+		start := (time.Duration(row.Start * float64(time.Second))).String()
+		line := []string{start, row.Hostname, row.Operation}
+		if showDatastore {
+			line = append(line, row.Datastore)
+		}
+		if showWithDefaults {
+			line = append(line, row.WithDefaults)
+		}
+		if showStage {
+			line = append(line, ts.StageLabel(row.Stage))
+		}
+		line = append(line, strconv.Itoa(row.Requests), strconv.Itoa(row.Errors), fmt.Sprintf("%.2f", row.TPS), fmt.Sprintf("%.2f", row.ErrorRate))
+		if row.Requests == row.Errors {
+			// no successful requests to report latencies for
+			line = append(line, "-")
+			for range percentiles {
+				line = append(line, "-")
+			}
+		} else {
+			line = append(line, fmt.Sprintf("%.2f", row.Mean*scale))
+			for _, p := range percentiles {
+				line = append(line, fmt.Sprintf("%.2f", row.Percentiles[percentileLabel(p)]*scale))
+			}
+		}
+		data = append(data, line)
+	}
+	return header, data
+}
+
+// writeTimelineCSV writes the timeline as csv for plotting, latencies are in milliseconds and are left empty for an
+// interval without successful requests, as are the datastore, with-defaults mode and stage of an operation without them
+func writeTimelineCSV(w io.Writer, rows []TimelineRow, percentiles []float64) error {
+	writer := csv.NewWriter(w)
+	header := []string{"Start", "Hostname", "Operation", "Datastore", "WithDefaults", "Stage", "Requests", "Errors", "TPS", "ErrorRate", "Mean"}
+	for _, p := range percentiles {
+		header = append(header, percentileLabel(p))
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, row := range rows {
+		stage := ""
+		if row.Stage != 0 {
+			stage = strconv.Itoa(row.Stage)
+		}
+		record := []string{format(row.Start), row.Hostname, row.Operation, row.Datastore, row.WithDefaults, stage, strconv.Itoa(row.Requests), strconv.Itoa(row.Errors),
+			format(row.TPS), format(row.ErrorRate)}
+		latencies := []float64{row.Mean}
+		for _, p := range percentiles {
+			latencies = append(latencies, row.Percentiles[percentileLabel(p)])
+		}
+		for _, latency := range latencies {
+			if row.Requests == row.Errors {
+				record = append(record, "")
+			} else {
+				record = append(record, format(latency))
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func init() {
+	AnalyseCmd.AddCommand(analyseTimelineCmd)
+	analyseTimelineCmd.Flags().Duration("interval", 10*time.Second, "the interval requests are grouped by, for e.g. 10s or 1m")
+	analyseTimelineCmd.Flags().String("format", FormatTable, "the output format, table, csv or json for plotting")
+	analyseTimelineCmd.Flags().String("percentiles", "50,90,99", "latency percentiles shown, a comma separated list; for e.g. 50,99 or empty for none")
+	analyseTimelineCmd.Flags().StringP("operation", "o", "", "filter based on operation type; for e.g. get, get-config, edit-config or commit")
+	analyseTimelineCmd.Flags().StringP("hostname", "", "", "filter based on host name or ip")
+}
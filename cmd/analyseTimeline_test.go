@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+)
+
+var timelineResults = []result.NetconfResult{
+	{Hostname: "10.0.0.1", Operation: "get", When: 500, Latency: 10},
+	{Hostname: "10.0.0.1", Operation: "get", When: 900, Latency: 30},
+	{Hostname: "10.0.0.1", Operation: "get", When: 1200, Err: "timeout"},
+	{Hostname: "10.0.0.1", Operation: "get", When: 3100, Latency: 20},
+	{Hostname: "10.0.0.2", Operation: "get-config", When: 1500, Latency: 5},
+	{Hostname: "10.0.0.1", Operation: "notification", When: 200, Latency: 1},
+}
+
+func TestTimeline(t *testing.T) {
+	rows := Timeline(timelineResults, time.Second, []float64{99}, "", "")
+	// 4 intervals for each host and operation, the third without any requests completing
+	assert.Len(t, rows, 8)
+
+	assert.Equal(t, TimelineRow{Start: 0, Hostname: "10.0.0.1", Operation: "get", Requests: 2, TPS: 2, Mean: 20, Percentiles: map[string]float64{"P99": 30}}, rows[0])
+	assert.Equal(t, TimelineRow{Start: 1, Hostname: "10.0.0.1", Operation: "get", Requests: 1, Errors: 1, TPS: 1, ErrorRate: 100}, rows[2])
+	assert.Equal(t, TimelineRow{Start: 1, Hostname: "10.0.0.2", Operation: "get-config", Requests: 1, TPS: 1, Mean: 5, Percentiles: map[string]float64{"P99": 5}}, rows[3])
+	assert.Equal(t, TimelineRow{Start: 2, Hostname: "10.0.0.1", Operation: "get"}, rows[4])
+	assert.Equal(t, 3.0, rows[6].Start)
+	assert.Equal(t, 1, rows[6].Requests)
+
+	rows = Timeline(timelineResults, 2*time.Second, nil, "", "10.0.0.2")
+	assert.Len(t, rows, 1)
+	assert.Equal(t, 0.5, rows[0].TPS)
+
+	assert.Empty(t, Timeline(timelineResults, time.Second, nil, "commit", ""))
+}
+
+func TestTimelineQualifiedOperations(t *testing.T) {
+	// operations against different datastores, with-defaults modes or stages are kept apart, as they are in analyse
+	results := []result.NetconfResult{
+		{Hostname: "10.0.0.1", Operation: "get-data", Datastore: "running", When: 100, Latency: 10},
+		{Hostname: "10.0.0.1", Operation: "get-data", Datastore: "operational", When: 200, Latency: 30},
+		{Hostname: "10.0.0.1", Operation: "get", WithDefaults: "trim", Stage: 2, When: 300, Latency: 5},
+		{Hostname: "10.0.0.1", Operation: "get", Stage: 1, When: 400, Latency: 7},
+	}
+	rows := Timeline(results, time.Second, nil, "", "")
+	assert.Equal(t, []TimelineRow{
+		{Hostname: "10.0.0.1", Operation: "get", Stage: 1, Requests: 1, TPS: 1, Mean: 7, Percentiles: map[string]float64{}},
+		{Hostname: "10.0.0.1", Operation: "get", WithDefaults: "trim", Stage: 2, Requests: 1, TPS: 1, Mean: 5, Percentiles: map[string]float64{}},
+		{Hostname: "10.0.0.1", Operation: "get-data", Datastore: "operational", Requests: 1, TPS: 1, Mean: 30, Percentiles: map[string]float64{}},
+		{Hostname: "10.0.0.1", Operation: "get-data", Datastore: "running", Requests: 1, TPS: 1, Mean: 10, Percentiles: map[string]float64{}},
+	}, rows)
+
+	ts := &suite.TestSuite{Stages: []suite.Stage{{Name: "warm-up"}, {}}}
+	header, data := timelineTable(ts, rows, nil)
+	assert.Equal(t, []string{"Start", "Host", "Operation", "Datastore", "With Defaults", "Stage", "Requests", "Errors", "TPS", "Error %", "Mean (ms)"}, header)
+	assert.Equal(t, []string{"0s", "10.0.0.1", "get", "", "", "warm-up", "1", "0", "1.00", "0.00", "7.00"}, data[0])
+	assert.Equal(t, []string{"0s", "10.0.0.1", "get-data", "operational", "", "", "1", "0", "1.00", "0.00", "30.00"}, data[2])
+}
+
+func Test_timelineTable(t *testing.T) {
+	rows := Timeline(timelineResults, time.Second, []float64{99}, "get", "")
+	header, data := timelineTable(&suite.TestSuite{}, rows, []float64{99})
+	assert.Equal(t, []string{"Start", "Host", "Operation", "Requests", "Errors", "TPS", "Error %", "Mean (ms)", "P99 (ms)"}, header)
+	assert.Equal(t, []string{"0s", "10.0.0.1", "get", "2", "0", "2.00", "0.00", "20.00", "30.00"}, data[0])
+	assert.Equal(t, []string{"1s", "10.0.0.1", "get", "1", "1", "1.00", "100.00", "-", "-"}, data[1])
+
+	// microseconds are used when all the latencies shown are under a millisecond
+	fast := []TimelineRow{{Hostname: "10.0.0.1", Operation: "get", Requests: 1, TPS: 1, Mean: 0.25, Percentiles: map[string]float64{"P99": 0.5}}}
+	header, data = timelineTable(&suite.TestSuite{}, fast, []float64{99})
+	assert.Equal(t, []string{"Start", "Host", "Operation", "Requests", "Errors", "TPS", "Error %", "Mean (µs)", "P99 (µs)"}, header)
+	assert.Equal(t, []string{"0s", "10.0.0.1", "get", "1", "0", "1.00", "0.00", "250.00", "500.00"}, data[0])
+}
+
+func Test_latencyUnit(t *testing.T) {
+	unit, scale := latencyUnit(nil)
+	assert.Equal(t, millisecondUnit, unit)
+	assert.Equal(t, 1.0, scale)
+	unit, scale = latencyUnit([]float64{0.25, 0.999})
+	assert.Equal(t, microsecondUnit, unit)
+	assert.Equal(t, 1000.0, scale)
+	unit, _ = latencyUnit([]float64{0.25, 3000})
+	assert.Equal(t, millisecondUnit, unit)
+}
+
+func Test_writeTimelineCSV(t *testing.T) {
+	rows := Timeline(timelineResults, time.Second, []float64{99}, "get", "")
+	var out bytes.Buffer
+	assert.Nil(t, writeTimelineCSV(&out, rows[:2], []float64{99}))
+	assert.Equal(t, "Start,Hostname,Operation,Datastore,WithDefaults,Stage,Requests,Errors,TPS,ErrorRate,Mean,P99\n0,10.0.0.1,get,,,,2,0,2,0,20,30\n1,10.0.0.1,get,,,,1,1,1,100,,\n", out.String())
+}
+
+func Test_AnalyseTimelineCmdArgs(t *testing.T) {
+	assert.Equal(t, errors.New("timeline command requires a test results directory as an argument"), analyseTimelineCmd.Args(myCmd, []string{}))
+	assert.Nil(t, analyseTimelineCmd.Args(myCmd, []string{"../results/2018-07-18-19-56-01/"}))
+}
+
+func Test_AnalyseTimelineCmdRun(t *testing.T) {
+	defer analyseTimelineCmd.Flags().Set("format", FormatTable)
+	stdout, logs := CaptureStdout(analyseTimelineCmd.Run, analyseTimelineCmd, []string{"../suite/testdata/results_test/2018-07-18-19-56-01/"})
+	assert.Contains(t, logs, "Requests grouped by the 10s interval they completed in")
+	assert.Contains(t, stdout, "START HOST OPERATION REQUESTS ERRORS TPS ERROR % MEAN (ms) P50 (ms) P90 (ms) P99 (ms)")
+
+	analyseTimelineCmd.Flags().Set("format", FormatJSON)
+	stdout, _ = CaptureStdout(analyseTimelineCmd.Run, analyseTimelineCmd, []string{"../suite/testdata/results_test/2018-07-18-19-56-01/"})
+	assert.Contains(t, stdout, `"hostname": "172.26.138.91"`)
+}
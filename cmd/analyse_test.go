@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"math"
 	"os"
@@ -22,6 +23,7 @@ import (
 	. "github.com/damianoneill/nc-hammer/suite"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/stat"
 )
 
@@ -53,7 +55,7 @@ func redirectOutput(mockResults []result.NetconfResult) (string, string) {
 	r, w, _ := os.Pipe()
 	os.Stdout = w
 
-	AnalyseResults(mockCmd, &mockTestSuite, mockResults)
+	AnalyseResults(mockCmd, &mockTestSuite, mockResults, nil)
 
 	// copy Stdout to buffer in a separate goroutine so printing can't block indefinitely
 	out := make(chan string)
@@ -111,7 +113,7 @@ func TestSortResults(t *testing.T) {
 
 func TestOrderAndExcludeErrValues(t *testing.T) {
 
-	var mockLatencies = make(map[string]map[string][]float64)
+	var mockLatencies = make(map[string]map[OperationKey][]float64)
 
 	testOrderExclude := func(t *testing.T, mockResults []result.NetconfResult, expected int) {
 
@@ -140,7 +142,7 @@ func TestOrderAndExcludeErrValues(t *testing.T) {
 func TestAnalyseResults(t *testing.T) {
 
 	var mockResults = []result.NetconfResult{mts1, mts2, mts3}
-	var mockLatencies = make(map[string]map[string][]float64)
+	var mockLatencies = make(map[string]map[OperationKey][]float64)
 
 	expectedStdout, expectedStderr := redirectOutput(mockResults)
 
@@ -181,18 +183,28 @@ func TestAnalyseResults(t *testing.T) {
 	t.Run("Check for correct output to Stdout - no flags set", func(t *testing.T) {
 
 		var consoleBuffer bytes.Buffer
-		consoleBuffer.WriteString("HOST OPERATION REUSE CONNECTION REQUESTS TPS MEAN VARIANCE STD DEVIATION ")
+		consoleBuffer.WriteString("HOST OPERATION REUSE CONNECTION REQUESTS TPS MEAN (ms) VARIANCE (ms²) STD DEVIATION (ms) MIN (ms) MAX (ms) ")
+
+		var when float64
+		for _, result := range mockResults {
+			if result.When > when {
+				when = result.When
+			}
+		}
+		executionTime := time.Duration(when) * time.Millisecond
 
 		keys := SortLatencies(mockLatencies)
 		for _, k := range keys {
 			host := k
 			operations := mockLatencies[k]
-			for operation, mockLatencies := range operations {
+			for _, operation := range SortOperations(operations) {
+				mockLatencies := operations[operation]
 				mean := stat.Mean(mockLatencies, nil)
-				tps := 1000 / mean
+				tps := float64(len(mockLatencies)) / executionTime.Seconds()
 				variance := stat.Variance(mockLatencies, nil)
 				stddev := math.Sqrt(variance)
-				consoleBuffer.WriteString(host + " " + operation + " " + strconv.FormatBool(mockTestSuite.Configs.IsReuseConnection(host)) + " " + strconv.Itoa(len(mockLatencies)) + " " + fmt.Sprintf("%.2f", tps) + " " + fmt.Sprintf("%.2f", mean) + " " + fmt.Sprintf("%.2f", variance) + " " + fmt.Sprintf("%.2f", stddev) + " ")
+				consoleBuffer.WriteString(host + " " + operation.Operation + " " + strconv.FormatBool(mockTestSuite.Configs.IsReuseConnection(host)) + " " + strconv.Itoa(len(mockLatencies)) + " " + fmt.Sprintf("%.2f", tps) + " " + fmt.Sprintf("%.2f", mean) + " " + fmt.Sprintf("%.2f", variance) + " " + fmt.Sprintf("%.2f", stddev) + " ")
+				consoleBuffer.WriteString(fmt.Sprintf("%.2f", floats.Min(mockLatencies)) + " " + fmt.Sprintf("%.2f", floats.Max(mockLatencies)) + " ")
 			}
 		}
 		actual := strings.Trim(consoleBuffer.String(), " ")
@@ -242,6 +254,260 @@ func TestAnalyseResultsWithFlags(t *testing.T) {
 	})
 }
 
+func TestAnalyseResultsWithDatastore(t *testing.T) {
+	getDataOperational := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get-data", Datastore: "operational", When: 100, Latency: 20}
+	getDataRunning := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get-data", Datastore: "running", When: 200, Latency: 10}
+
+	stdout, _ := redirectOutput([]result.NetconfResult{getDataRunning, getDataOperational, mts1})
+
+	assert.Contains(t, stdout, "HOST OPERATION DATASTORE REUSE CONNECTION")
+	assert.Contains(t, stdout, "10.0.0.1 edit-config false 1 0.02 288.00")
+	assert.Contains(t, stdout, "10.0.0.4 get-data operational false 1 0.02 20.00")
+	assert.Contains(t, stdout, "10.0.0.4 get-data running false 1 0.02 10.00")
+}
+
+func TestAnalyseResultsWithDefaults(t *testing.T) {
+	reportAll := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", WithDefaults: "report-all", When: 100, Latency: 40}
+	trim := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", WithDefaults: "trim", When: 200, Latency: 10}
+
+	stdout, _ := redirectOutput([]result.NetconfResult{trim, reportAll})
+
+	assert.Contains(t, stdout, "HOST OPERATION WITH DEFAULTS REUSE CONNECTION")
+	assert.Contains(t, stdout, "10.0.0.4 get report-all false 1 5.00 40.00")
+	assert.Contains(t, stdout, "10.0.0.4 get trim false 1 5.00 10.00")
+}
+
+func TestAnalyseResultsWithStages(t *testing.T) {
+	warmup := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", Stage: 1, When: 100, Latency: 40}
+	plateau := result.NetconfResult{Client: 2, SessionID: 82, Hostname: "10.0.0.4", Operation: "get", Stage: 2, When: 200, Latency: 10}
+	mockTestSuite.Stages = []Stage{{Name: "warm-up", Clients: 5, Duration: 60, Ramp: true}, {Clients: 10, Duration: 300}}
+	defer func() { mockTestSuite.Stages = nil }()
+
+	stdout, stderr := redirectOutput([]result.NetconfResult{plateau, warmup})
+
+	assert.Contains(t, stdout, "HOST OPERATION STAGE REUSE CONNECTION")
+	assert.Contains(t, stdout, "10.0.0.4 get warm-up false 1 0.02 40.00")
+	assert.Contains(t, stdout, "10.0.0.4 get 2 false 1 0.00 10.00")
+	assert.Contains(t, stderr, "Stage warm-up: ramping to 5 client(s) for 60 seconds")
+	assert.Contains(t, stderr, "Stage 2: 10 client(s) for 300 seconds")
+}
+
+func TestAnalyseResultsWithCorrectedLatency(t *testing.T) {
+	onTime := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", When: 100, Latency: 10, Sent: 90, Intended: 90}
+	queued := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", When: 200, Latency: 10, Sent: 190, Intended: 160}
+
+	stdout, stderr := redirectOutput([]result.NetconfResult{onTime, queued})
+
+	assert.Contains(t, stdout, "STD DEVIATION (ms) MIN (ms) MAX (ms) CORRECTED MEAN (ms) CORRECTED MAX (ms)")
+	assert.Contains(t, stdout, "10.0.0.4 get false 2 10.00 10.00 0.00 0.00 10.00 10.00 25.00 40.00")
+	assert.Contains(t, stderr, "Corrected latencies are measured from when requests were intended to be sent")
+
+	mockCmd.Flags().String("percentiles", "50,99", "")
+	defer mockCmd.ResetFlags()
+	stdout, _ = redirectOutput([]result.NetconfResult{onTime, queued})
+	assert.Contains(t, stdout, "MIN (ms) MAX (ms) P50 (ms) P99 (ms) CORRECTED MEAN (ms) CORRECTED MAX (ms) CORRECTED P50 (ms) CORRECTED P99 (ms)")
+	assert.Contains(t, stdout, "10.00 10.00 10.00 10.00 25.00 40.00 10.01 40.00")
+}
+
+func TestCorrectedLatencies(t *testing.T) {
+	results := []result.NetconfResult{
+		result.NetconfResult{Hostname: "10.0.0.1", Operation: "get", Latency: 10, Sent: 50, Intended: 20},
+		result.NetconfResult{Hostname: "10.0.0.1", Operation: "get", Latency: 10, Sent: 5},
+		result.NetconfResult{Hostname: "10.0.0.1", Operation: "get", Err: "timeout", Sent: 80, Intended: 70},
+	}
+	corrected, found := CorrectedLatencies(results)
+	assert.True(t, found)
+	assert.Equal(t, []float64{40, 10}, corrected["10.0.0.1"][OperationKey{Operation: "get"}])
+
+	_, found = CorrectedLatencies(results[1:2])
+	assert.False(t, found)
+}
+
+func TestAnalyseResultsWithPercentiles(t *testing.T) {
+	var results []result.NetconfResult
+	for i := 1; i <= 100; i++ {
+		results = append(results, result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", When: float64(i * 10), Latency: float64(i)})
+	}
+	mockCmd.Flags().String("percentiles", "50,99.9", "")
+	defer mockCmd.ResetFlags()
+
+	stdout, _ := redirectOutput(results)
+
+	assert.Contains(t, stdout, "STD DEVIATION (ms) MIN (ms) MAX (ms) P50 (ms) P99.9 (ms)")
+	// 100 requests over the 1s between the start of the run and the last completing
+	assert.Contains(t, stdout, "10.0.0.4 get false 100 100.00 50.50")
+	// percentiles are recorded to three significant digits
+	assert.Contains(t, stdout, "1.00 100.00 50.02 100.00")
+}
+
+func TestAnalyseResultsWithRunWindow(t *testing.T) {
+	get := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", When: 100, Latency: 10}
+	started := time.Now()
+	run := &result.RunInfo{Started: started, Completed: started.Add(4 * time.Second), StopReason: result.StopReasonIterations}
+
+	log.SetOutput(ioutil.Discard)
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	AnalyseResults(mockCmd, &mockTestSuite, []result.NetconfResult{get, get}, run)
+	w.Close()
+	os.Stdout = old
+	out, _ := ioutil.ReadAll(r)
+
+	assert.Regexp(t, `10\.0\.0\.4\s+get\s+false\s+2\s+0\.50\s+10\.00`, string(out))
+}
+
+func TestAnalyseResultsSubMillisecond(t *testing.T) {
+	fast := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", When: 0.5, Latency: 0.25}
+	faster := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", When: 1.25, Latency: 0.125}
+
+	stdout, stderr := redirectOutput([]result.NetconfResult{fast, faster})
+
+	assert.Contains(t, stderr, "Total execution time: 1.25ms")
+	assert.Contains(t, stdout, "MEAN (µs) VARIANCE (µs²) STD DEVIATION (µs) MIN (µs) MAX (µs)")
+	assert.Contains(t, stdout, "10.0.0.4 get false 2 1600.00 187.50 7812.50 88.39 125.00 250.00")
+
+	// the unit of the connection setup table is chosen from its own times
+	fast.Connect, fast.Handshake, fast.Hello = 0.25, 0.5, 0.125
+	stdout, _ = redirectOutput([]result.NetconfResult{fast, faster})
+	assert.Contains(t, stdout, "MEAN CONNECT (µs) MEAN HANDSHAKE (µs) MEAN HELLO (µs) MEAN SETUP (µs) MAX SETUP (µs)")
+	assert.Contains(t, stdout, "10.0.0.4 false 1 250.00 500.00 125.00 875.00 875.00")
+	fast.Handshake = 20
+	stdout, _ = redirectOutput([]result.NetconfResult{fast, faster})
+	assert.Contains(t, stdout, "MEAN CONNECT (ms) MEAN HANDSHAKE (ms) MEAN HELLO (ms) MEAN SETUP (ms) MAX SETUP (ms)")
+	assert.Contains(t, stdout, "MEAN (µs) VARIANCE (µs²)")
+}
+
+func TestAnalyseResultsMixedUnits(t *testing.T) {
+	// a slow operation is not reported in microseconds because another completed in under a millisecond
+	fast := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "get", When: 0.5, Latency: 0.25}
+	slow := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.4", Operation: "edit-config", When: 3000, Latency: 3000}
+
+	stdout, _ := redirectOutput([]result.NetconfResult{fast, slow})
+	assert.Contains(t, stdout, "MEAN (ms) VARIANCE (ms²)")
+	assert.Contains(t, stdout, "10.0.0.4 edit-config false 1 0.33 3000.00")
+	assert.Contains(t, stdout, "10.0.0.4 get false 1 0.33 0.25")
+}
+
+func TestParsePercentiles(t *testing.T) {
+	percentiles, err := ParsePercentiles("50, 99.9,,100")
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{50, 99.9, 100}, percentiles)
+
+	percentiles, err = ParsePercentiles("")
+	assert.Nil(t, err)
+	assert.Empty(t, percentiles)
+
+	_, err = ParsePercentiles("p99")
+	assert.EqualError(t, err, "percentile p99 must be a number greater than 0 and at most 100")
+	_, err = ParsePercentiles("0")
+	assert.EqualError(t, err, "percentile 0 must be a number greater than 0 and at most 100")
+}
+
+func TestAnalyseResultsWithTransport(t *testing.T) {
+	tlsResult := result.NetconfResult{Client: 1, SessionID: 81, Hostname: "10.0.0.5", Operation: "get", When: 100, Latency: 20}
+	mockTestSuite.Configs = Configs{Sshconfig{Hostname: "10.0.0.1"}, Sshconfig{Hostname: "10.0.0.5", Transport: TransportTLS}}
+	defer func() { mockTestSuite.Configs = nil }()
+
+	stdout, _ := redirectOutput([]result.NetconfResult{tlsResult, mts1})
+
+	assert.Contains(t, stdout, "HOST OPERATION TRANSPORT REUSE CONNECTION")
+	assert.Contains(t, stdout, "10.0.0.1 edit-config ssh false 1")
+	assert.Contains(t, stdout, "10.0.0.5 get tls false 1")
+}
+
+func TestAnalyseNotifications(t *testing.T) {
+	results := []result.NetconfResult{
+		result.NetconfResult{Client: 0, SessionID: 10, Hostname: "10.0.0.1", Operation: "create-subscription", When: 90, Latency: 5},
+		result.NetconfResult{Client: 0, SessionID: 10, Hostname: "10.0.0.1", Operation: "notification", Stream: "NETCONF", When: 100, Latency: 4},
+		result.NetconfResult{Client: 0, SessionID: 10, Hostname: "10.0.0.1", Operation: "notification", Stream: "NETCONF", When: 300, Latency: 8},
+		result.NetconfResult{Client: 1, SessionID: 11, Hostname: "10.0.0.1", Operation: "notification", Stream: "NETCONF", When: 150, Latency: 6},
+		result.NetconfResult{Client: 1, SessionID: 11, Hostname: "10.0.0.1", Operation: "notification", Stream: "NETCONF", When: 250, Latency: 6},
+		result.NetconfResult{Client: 1, SessionID: 12, Hostname: "10.0.0.2", Operation: "notification", Stream: "yang-push", Datastore: "operational", When: 250, Latency: 2},
+		result.NetconfResult{Client: 1, SessionID: 12, Hostname: "10.0.0.2", Operation: "notification", Stream: "yang-push", When: 260, Err: "session closed by remote side"},
+	}
+
+	expected := [][]string{
+		{"10.0.0.1", "NETCONF", "4", "150.00", "200.00", "6.00", "8.00"},
+		{"10.0.0.2", "yang-push (operational)", "1", "-", "-", "2.00", "2.00"},
+	}
+	data, unit := AnalyseNotifications(results, "")
+	assert.Equal(t, expected, data)
+	assert.Equal(t, "ms", unit)
+	data, _ = AnalyseNotifications(results, "10.0.0.2")
+	assert.Equal(t, expected[1:], data)
+
+	stdout, stderr := redirectOutput(results)
+	assert.Contains(t, stdout, "HOST STREAM NOTIFICATIONS MEAN GAP (ms) MAX GAP (ms) MEAN DELAY (ms) MAX DELAY (ms)")
+	assert.Contains(t, stdout, "10.0.0.1 create-subscription false 1")
+	assert.NotContains(t, stdout, "10.0.0.1 notification")
+	assert.Contains(t, stderr, "Suite execution contained 1 errors")
+}
+
+func TestAnalyseConnections(t *testing.T) {
+	results := []result.NetconfResult{
+		result.NetconfResult{Client: 0, Hostname: "10.0.0.1", Operation: "get", Latency: 5, Connect: 1, Handshake: 20, Hello: 3},
+		result.NetconfResult{Client: 1, Hostname: "10.0.0.1", Operation: "get", Latency: 5, Connect: 3, Handshake: 40, Hello: 5},
+		result.NetconfResult{Client: 0, Hostname: "10.0.0.1", Operation: "get", Latency: 5},
+		result.NetconfResult{Client: 0, Hostname: "10.0.0.2", Operation: "get", Latency: 5, Connect: 0.5, Handshake: 10.25, Hello: 1.25},
+	}
+	configs := Configs{Sshconfig{Hostname: "10.0.0.1", Reuseconnection: true}, Sshconfig{Hostname: "10.0.0.2"}}
+
+	expected := [][]string{
+		{"10.0.0.1", "true", "2", "2.00", "30.00", "4.00", "36.00", "48.00"},
+		{"10.0.0.2", "false", "1", "0.50", "10.25", "1.25", "12.00", "12.00"},
+	}
+	data, unit := AnalyseConnections(results, configs, "")
+	assert.Equal(t, expected, data)
+	assert.Equal(t, "ms", unit)
+	data, _ = AnalyseConnections(results, configs, "10.0.0.2")
+	assert.Equal(t, expected[1:], data)
+
+	stdout, _ := redirectOutput(results)
+	assert.Contains(t, stdout, "HOST REUSE CONNECTION SESSIONS MEAN CONNECT (ms) MEAN HANDSHAKE (ms) MEAN HELLO (ms) MEAN SETUP (ms) MAX SETUP (ms)")
+
+	// archives without timings do not include the table
+	stdout, _ = redirectOutput(results[2:3])
+	assert.NotContains(t, stdout, "MEAN CONNECT")
+}
+
+func TestAnalyseResultsWithRunInfo(t *testing.T) {
+	var logOut bytes.Buffer
+	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
+	log.SetOutput(&logOut)
+	old := os.Stdout
+	_, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() { os.Stdout = old }()
+
+	ts := TestSuite{File: "testdata/emptytestsuite.yml", Clients: 2, Duration: 1800}
+	AnalyseResults(mockCmd, &ts, []result.NetconfResult{}, &result.RunInfo{Iterations: 4210, StopReason: result.StopReasonDuration})
+	w.Close()
+
+	assert.Contains(t, logOut.String(), "Run limited to a duration of 30m0s")
+	assert.Contains(t, logOut.String(), "Run stopped as the duration limit was reached, 4210 iterations completed")
+}
+
+func TestSortOperations(t *testing.T) {
+	operations := map[OperationKey][]float64{
+		OperationKey{Operation: "get-data", Datastore: "running"}:     nil,
+		OperationKey{Operation: "get", WithDefaults: "trim"}:          nil,
+		OperationKey{Operation: "get"}:                                nil,
+		OperationKey{Operation: "get-data", Datastore: "operational"}: nil,
+	}
+	operations[OperationKey{Operation: "get", Stage: 2}] = nil
+	operations[OperationKey{Operation: "get", Stage: 1}] = nil
+	expected := []OperationKey{
+		OperationKey{Operation: "get"},
+		OperationKey{Operation: "get", Stage: 1},
+		OperationKey{Operation: "get", Stage: 2},
+		OperationKey{Operation: "get", WithDefaults: "trim"},
+		OperationKey{Operation: "get-data", Datastore: "operational"},
+		OperationKey{Operation: "get-data", Datastore: "running"},
+	}
+	assert.Equal(t, expected, SortOperations(operations))
+}
+
 // Test to check handling of arguments in AnalyseCmd.Args
 func TestAnalyseCmdArgs(t *testing.T) {
 
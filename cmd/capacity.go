@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/action"
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"gonum.org/v1/gonum/stat"
+)
+
+// capacityCmd represents the capacity command
+var capacityCmd = &cobra.Command{
+	Use:   "capacity <test suite file>",
+	Short: "Search for the highest load a device sustains by running a Test Suite at increasing load",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("capacity command requires a test suite file as an argument")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		ts, err := suite.NewTestSuite(args[0])
+		if err != nil {
+			log.Fatalf("Problem with YAML file: %v ", err)
+		}
+		if len(ts.Stages) > 0 {
+			log.Fatalf("Problem with YAML file: capacity cannot be used with stages ")
+		}
+		//nolint
+		start, _ := cmd.Flags().GetFloat64("start")
+		//nolint
+		step, _ := cmd.Flags().GetFloat64("step")
+		//nolint
+		max, _ := cmd.Flags().GetFloat64("max")
+		var thresholds CapacityThresholds
+		//nolint
+		thresholds.Percentile, _ = cmd.Flags().GetFloat64("percentile")
+		//nolint
+		thresholds.Latency, _ = cmd.Flags().GetFloat64("latency")
+		//nolint
+		thresholds.ErrorRate, _ = cmd.Flags().GetFloat64("error-rate")
+		if start <= 0 || step <= 0 || max < start {
+			log.Fatalf("Problem with capacity flags: start and step must be greater than zero and max at least start ")
+		}
+		if thresholds.Percentile <= 0 || thresholds.Percentile > 100 {
+			log.Fatalf("Problem with capacity flags: percentile must be greater than 0 and at most 100 ")
+		}
+
+		steps := SearchCapacity(ts, start, step, max, thresholds, runTestSuite)
+		ReportCapacity(ts, steps, max, thresholds)
+	},
+}
+
+// CapacityThresholds define when a step of a capacity search is no longer sustained, a latency of zero is not checked
+type CapacityThresholds struct {
+	Percentile float64 // the latency percentile checked, for e.g. 99
+	Latency    float64 // milliseconds
+	ErrorRate  float64 // percentage of requests
+}
+
+// CapacityStep summarises a step of a capacity search, the load is the number of clients or the target rate
+type CapacityStep struct {
+	Load       float64
+	Results    string
+	Requests   int
+	Errors     int
+	TPS        float64
+	Mean       float64
+	Percentile float64
+	Exceeded   string // the threshold exceeded, empty if the load was sustained
+}
+
+// SearchCapacity runs the suite at increasing load, the clients or the target rate for an open model, from start by
+// step until max or a threshold is exceeded. Each step is run and archived by the run function
+func SearchCapacity(ts *suite.TestSuite, start, step, max float64, thresholds CapacityThresholds, run func(*suite.TestSuite) string) []CapacityStep {
+	var steps []CapacityStep
+	for i := 0; ; i++ {
+		load := start + float64(i)*step
+		if load > max {
+			break
+		}
+		log.Printf("Capacity step %d, %v\n", i+1, loadLabel(ts, load))
+		path := run(withLoad(ts, load))
+		results, _, err := result.UnarchiveResults(path)
+		if err != nil {
+			log.Fatalf("Problem with loading result information: %v ", err)
+		}
+		runInfo, err := result.UnarchiveRunInfo(path)
+		if err != nil {
+			log.Fatalf("Problem with loading run information: %v ", err)
+		}
+		s := EvaluateStep(load, results, runInfo, thresholds)
+		s.Results = path
+		steps = append(steps, s)
+		if s.Exceeded != "" {
+			break
+		}
+	}
+	return steps
+}
+
+// withLoad returns a copy of the suite with the load applied, as the clients or the target rate for an open model
+func withLoad(ts *suite.TestSuite, load float64) *suite.TestSuite {
+	stepTs := *ts
+	if ts.Rate != nil {
+		rate := *ts.Rate
+		rate.Target = load
+		stepTs.Rate = &rate
+	} else {
+		stepTs.Clients = int(math.Round(load))
+	}
+	return &stepTs
+}
+
+func loadLabel(ts *suite.TestSuite, load float64) string {
+	if ts.Rate != nil {
+		return fmt.Sprintf("%.2f %v(s) per second", load, ts.Rate.GetUnit())
+	}
+	return fmt.Sprintf("%d client(s)", int(math.Round(load)))
+}
+
+// EvaluateStep summarises the results of a step and checks them against the thresholds. Throughput is the successful
+// requests over the runs wall clock time, notifications are not counted as requests
+func EvaluateStep(load float64, results []result.NetconfResult, run *result.RunInfo, thresholds CapacityThresholds) CapacityStep {
+	s := CapacityStep{Load: load}
+	var latencies []float64
+	var when float64
+	for idx := range results {
+		if results[idx].Operation == action.NotificationOperation {
+			continue
+		}
+		s.Requests++
+		if results[idx].When > when {
+			when = results[idx].When
+		}
+		if results[idx].Err != "" {
+			s.Errors++
+			continue
+		}
+		latencies = append(latencies, results[idx].Latency)
+	}
+
+	window := time.Duration(when * float64(time.Millisecond))
+	if run != nil {
+		window = run.Completed.Sub(run.Started)
+	}
+	s.TPS = measuredTPS(len(latencies), window)
+	if len(latencies) > 0 {
+		s.Mean = stat.Mean(latencies, nil)
+		// percentiles are taken from a histogram as they are in analyse, so that both report the same value
+		s.Percentile = latencyHistogram(latencies).Percentile(thresholds.Percentile)
+	}
+
+	switch {
+	case s.Requests == 0:
+		s.Exceeded = "no requests were sent"
+	case float64(s.Errors)*100/float64(s.Requests) > thresholds.ErrorRate:
+		s.Exceeded = fmt.Sprintf("error rate %.2f%% > %.2f%%", float64(s.Errors)*100/float64(s.Requests), thresholds.ErrorRate)
+	case thresholds.Latency > 0 && s.Percentile > thresholds.Latency:
+		s.Exceeded = fmt.Sprintf("%v %.2f > %.2f", percentileLabel(thresholds.Percentile), s.Percentile, thresholds.Latency)
+	}
+	return s
+}
+
+func percentileLabel(p float64) string {
+	return "P" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// ReportCapacity renders the throughput and latency of each step and the highest load sustained
+func ReportCapacity(ts *suite.TestSuite, steps []CapacityStep, max float64, thresholds CapacityThresholds) {
+	load := "Clients"
+	if ts.Rate != nil {
+		load = "Rate"
+	}
+	data := [][]string{}
+	for _, s := range steps {
+		status := "sustained"
+		if s.Exceeded != "" {
+			status = s.Exceeded
+		}
+		errorRate := 0.0
+		if s.Requests > 0 {
+			errorRate = float64(s.Errors) * 100 / float64(s.Requests)
+		}
+		data = append(data, []string{strconv.FormatFloat(s.Load, 'f', -1, 64), strconv.Itoa(s.Requests), fmt.Sprintf("%.2f", errorRate),
+			fmt.Sprintf("%.2f", s.TPS), fmt.Sprintf("%.2f", s.Mean), fmt.Sprintf("%.2f", s.Percentile), s.Results, status})
+	}
+	log.Println("")
+	var table = tablewriter.NewWriter(os.Stdout)
+	renderTable(table, []string{load, "Requests", "Error %", "TPS", "Mean", percentileLabel(thresholds.Percentile), "Results", "Status"}, &data)
+	table.Render()
+
+	var sustained *CapacityStep
+	for idx := range steps {
+		if steps[idx].Exceeded == "" {
+			sustained = &steps[idx]
+		}
+	}
+	switch {
+	case sustained == nil:
+		log.Printf("No load was sustained, the first step exceeded a threshold\n")
+	case len(steps) > 0 && steps[len(steps)-1].Exceeded == "":
+		log.Printf("Highest load sustained %v at %.2f TPS, the maximum load of %v was reached without exceeding a threshold\n", loadLabel(ts, sustained.Load), sustained.TPS, strconv.FormatFloat(max, 'f', -1, 64))
+	default:
+		log.Printf("Highest load sustained %v at %.2f TPS\n", loadLabel(ts, sustained.Load), sustained.TPS)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(capacityCmd)
+	capacityCmd.Flags().Float64("start", 1, "the load of the first step, clients or the target rate when the suite defines a rate")
+	capacityCmd.Flags().Float64("step", 1, "the load added at each step")
+	capacityCmd.Flags().Float64("max", 100, "the load at which the search stops if a threshold has not been exceeded")
+	capacityCmd.Flags().Float64("percentile", 99, "the latency percentile checked against the latency threshold")
+	capacityCmd.Flags().Float64("latency", 0, "the latency threshold in milliseconds, not checked if zero")
+	capacityCmd.Flags().Float64("error-rate", 1, "the error rate threshold as a percentage of requests")
+}
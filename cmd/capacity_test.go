@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_capacityCmdArgs(t *testing.T) {
+	assert.Equal(t, errors.New("capacity command requires a test suite file as an argument"), capacityCmd.Args(myCmd, []string{}))
+	assert.Nil(t, capacityCmd.Args(myCmd, []string{"../suite/testdata/test-suite.yml"}))
+}
+
+// fakeCapacityRun archives 100 results per step, latency grows with the clients and errors start at 4 clients
+func fakeCapacityRun(ts *suite.TestSuite) string {
+	var results []result.NetconfResult
+	for i := 0; i < 100; i++ {
+		r := result.NetconfResult{Hostname: "10.0.0.1", Operation: "get", When: float64(i * 10), Latency: float64(ts.Clients*10 + i%10)}
+		if ts.Clients >= 4 && i%10 == 0 {
+			r.Err = "session closed by remote side"
+		}
+		results = append(results, r)
+	}
+	started := time.Now()
+	run := &result.RunInfo{Started: started, Completed: started.Add(time.Second)}
+	path, _ := result.ArchiveResults(results, &suite.TestSuite{Configs: suite.Configs{suite.Sshconfig{Hostname: "10.0.0.1", Username: "u", Password: "p"}}}, run)
+	return path
+}
+
+func TestSearchCapacity(t *testing.T) {
+	defer os.RemoveAll("results")
+	ts := &suite.TestSuite{Clients: 1}
+
+	t.Run("error rate exceeded", func(t *testing.T) {
+		steps := SearchCapacity(ts, 1, 1, 10, CapacityThresholds{Percentile: 99, ErrorRate: 1}, fakeCapacityRun)
+		assert.Len(t, steps, 4)
+		assert.Equal(t, "", steps[2].Exceeded)
+		assert.Equal(t, "error rate 10.00% > 1.00%", steps[3].Exceeded)
+		assert.Equal(t, 100.0, steps[0].TPS)
+		assert.Equal(t, 14.5, steps[0].Mean)
+	})
+	t.Run("latency exceeded", func(t *testing.T) {
+		steps := SearchCapacity(ts, 1, 1, 10, CapacityThresholds{Percentile: 99, Latency: 25, ErrorRate: 100}, fakeCapacityRun)
+		assert.Len(t, steps, 2)
+		assert.Equal(t, "P99 29.00 > 25.00", steps[1].Exceeded)
+	})
+	t.Run("max reached", func(t *testing.T) {
+		steps := SearchCapacity(ts, 1, 2, 4, CapacityThresholds{Percentile: 99, ErrorRate: 100}, fakeCapacityRun)
+		assert.Len(t, steps, 2)
+		assert.Equal(t, 3.0, steps[1].Load)
+		stdout, stderr := captureCapacityReport(ts, steps, 4)
+		assert.Contains(t, stdout, "CLIENTS REQUESTS ERROR % TPS MEAN P99 RESULTS STATUS")
+		assert.Contains(t, stderr, "Highest load sustained 3 client(s) at 100.00 TPS, the maximum load of 4 was reached without exceeding a threshold")
+	})
+}
+
+func captureCapacityReport(ts *suite.TestSuite, steps []CapacityStep, max float64) (string, string) {
+	return CaptureStdout(func(*cobra.Command, []string) {
+		ReportCapacity(ts, steps, max, CapacityThresholds{Percentile: 99})
+	}, myCmd, nil)
+}
+
+func TestEvaluateStep(t *testing.T) {
+	results := []result.NetconfResult{
+		{Operation: "get", When: 1000, Latency: 10},
+		{Operation: "get", When: 2000, Latency: 30},
+		{Operation: "notification", When: 2500, Latency: 1},
+		{Operation: "get", When: 3000, Err: "expected response did not match"},
+	}
+	s := EvaluateStep(2, results, nil, CapacityThresholds{Percentile: 50, ErrorRate: 50})
+	assert.Equal(t, 3, s.Requests)
+	assert.Equal(t, 1, s.Errors)
+	assert.InDelta(t, 0.67, s.TPS, 0.01)
+	assert.Equal(t, 20.0, s.Mean)
+	// the percentile is taken from a histogram, recorded to three significant digits, as it is in analyse
+	assert.InDelta(t, 10.0, s.Percentile, 0.01)
+	assert.Equal(t, latencyHistogram([]float64{10, 30}).Percentile(50), s.Percentile)
+	assert.Equal(t, "", s.Exceeded)
+
+	assert.Equal(t, "no requests were sent", EvaluateStep(1, nil, nil, CapacityThresholds{Percentile: 99}).Exceeded)
+}
+
+func Test_withLoad(t *testing.T) {
+	ts := &suite.TestSuite{Clients: 1}
+	assert.Equal(t, 3, withLoad(ts, 3).Clients)
+	assert.Equal(t, 1, ts.Clients)
+
+	ts.Rate = &suite.Rate{Target: 10}
+	assert.Equal(t, 25.0, withLoad(ts, 25).Rate.Target)
+	assert.Equal(t, 10.0, ts.Rate.Target)
+}
@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/damianoneill/nc-hammer/action"
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// compareCmd represents the compare command
+var compareCmd = &cobra.Command{
+	Use:   "compare <baseline results> <candidate results>",
+	Short: "Compare the results of two Test Suite runs for regressions",
+	Long: `Compares the results of a candidate run of a Test Suite with a baseline run, matching each host and operation.
+
+The command exits with status 1 when the candidate regressed, when a latency, tps or error-rate threshold is
+exceeded or, unless --significant=false, when the candidate latencies are significantly higher than the baseline
+(Mann-Whitney U test at the --alpha significance level). The latency, tps and error-rate thresholds are not
+checked unless they are set, so by default only a significant increase in latency fails the comparison.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("compare command requires a baseline and a candidate test results directory as arguments")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var thresholds CompareThresholds
+		//nolint
+		flag, _ := cmd.Flags().GetString("percentiles")
+		//nolint
+		thresholds.Percentile, _ = cmd.Flags().GetFloat64("percentile")
+		//nolint
+		thresholds.Latency, _ = cmd.Flags().GetFloat64("latency")
+		//nolint
+		thresholds.TPS, _ = cmd.Flags().GetFloat64("tps")
+		//nolint
+		thresholds.ErrorRate, _ = cmd.Flags().GetFloat64("error-rate")
+		//nolint
+		thresholds.Alpha, _ = cmd.Flags().GetFloat64("alpha")
+		//nolint
+		thresholds.Significant, _ = cmd.Flags().GetBool("significant")
+		percentiles, err := ParsePercentiles(flag)
+		if err != nil {
+			log.Fatalf("Problem with percentiles flag: %v ", err)
+		}
+		if thresholds.Percentile <= 0 || thresholds.Percentile > 100 {
+			log.Fatalf("Problem with compare flags: percentile must be greater than 0 and at most 100 ")
+		}
+		if thresholds.Alpha <= 0 || thresholds.Alpha >= 1 {
+			log.Fatalf("Problem with compare flags: alpha must be greater than 0 and less than 1 ")
+		}
+
+		baseline, err := LoadRunResults(args[0])
+		if err != nil {
+			log.Fatalf("Problem with loading baseline result information: %v ", err)
+		}
+		candidate, err := LoadRunResults(args[1])
+		if err != nil {
+			log.Fatalf("Problem with loading candidate result information: %v ", err)
+		}
+
+		comparisons := CompareRuns(baseline, candidate, append(percentiles, thresholds.Percentile), thresholds)
+		if ReportComparison(candidate.TestSuite, comparisons, percentiles, thresholds) {
+			os.Exit(1)
+		}
+	},
+}
+
+// CompareThresholds define when a candidate run has regressed from its baseline, a threshold of zero is not checked
+type CompareThresholds struct {
+	Percentile  float64 // the latency percentile checked, for e.g. 99
+	Latency     float64 // maximum increase in the latency percentile as a percentage of the baseline
+	TPS         float64 // maximum decrease in TPS as a percentage of the baseline
+	ErrorRate   float64 // maximum increase in the error rate in percentage points
+	Alpha       float64 // the significance level of the Mann-Whitney test
+	Significant bool    // fail when the latencies are significantly higher
+}
+
+// RunResults are the archived results of a run, the run information is nil for results archived by earlier versions
+type RunResults struct {
+	TestSuite *suite.TestSuite
+	Results   []result.NetconfResult
+	Run       *result.RunInfo
+}
+
+// LoadRunResults loads the archived results of a run
+func LoadRunResults(path string) (*RunResults, error) {
+	results, ts, err := result.UnarchiveResults(path)
+	if err != nil {
+		return nil, err
+	}
+	run, err := result.UnarchiveRunInfo(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RunResults{TestSuite: ts, Results: results, Run: run}, nil
+}
+
+// RunSummary summarises the requests to a host for an operation in a run, percentiles are of the successful requests
+type RunSummary struct {
+	Requests    int
+	Errors      int
+	TPS         float64
+	ErrorRate   float64 // percentage of requests
+	Percentiles map[float64]float64
+	latencies   []float64
+}
+
+// Comparison compares the requests to a host for an operation in the baseline and candidate runs, a summary is nil
+// when the operation was only sent in one of the runs
+type Comparison struct {
+	Hostname    string
+	Key         OperationKey
+	Baseline    *RunSummary
+	Candidate   *RunSummary
+	PValue      float64  // the probability that the latencies come from the same distribution
+	Significant bool     // the candidate latencies are significantly higher than the baseline
+	Exceeded    []string // the thresholds exceeded
+}
+
+// CompareRuns matches the host and operation rows of two runs, comparing the latency percentiles, TPS and error rate
+// and testing whether the candidate latencies are significantly higher using the Mann-Whitney U test
+func CompareRuns(baseline, candidate *RunResults, percentiles []float64, thresholds CompareThresholds) []Comparison {
+	baselineSummaries := summariseRun(baseline, percentiles)
+	candidateSummaries := summariseRun(candidate, percentiles)
+
+	type rowKey struct {
+		hostname string
+		key      OperationKey
+	}
+	rows := make(map[rowKey]*Comparison)
+	for hostname, operations := range baselineSummaries {
+		for key, summary := range operations {
+			rows[rowKey{hostname, key}] = &Comparison{Hostname: hostname, Key: key, Baseline: summary}
+		}
+	}
+	for hostname, operations := range candidateSummaries {
+		for key, summary := range operations {
+			if c, present := rows[rowKey{hostname, key}]; present {
+				c.Candidate = summary
+			} else {
+				rows[rowKey{hostname, key}] = &Comparison{Hostname: hostname, Key: key, Candidate: summary}
+			}
+		}
+	}
+
+	var comparisons []Comparison
+	for _, c := range rows {
+		c.PValue = 1
+		if c.Baseline != nil && c.Candidate != nil {
+			c.PValue = MannWhitney(c.Baseline.latencies, c.Candidate.latencies)
+			c.Significant = c.PValue < thresholds.Alpha && median(c.Candidate.latencies) > median(c.Baseline.latencies)
+			c.Exceeded = exceededThresholds(c, thresholds)
+		}
+		comparisons = append(comparisons, *c)
+	}
+	sort.Slice(comparisons, func(i, j int) bool {
+		if comparisons[i].Hostname != comparisons[j].Hostname {
+			return comparisons[i].Hostname < comparisons[j].Hostname
+		}
+		ki, kj := comparisons[i].Key, comparisons[j].Key
+		if ki.Operation != kj.Operation {
+			return ki.Operation < kj.Operation
+		}
+		if ki.Datastore != kj.Datastore {
+			return ki.Datastore < kj.Datastore
+		}
+		if ki.WithDefaults != kj.WithDefaults {
+			return ki.WithDefaults < kj.WithDefaults
+		}
+		return ki.Stage < kj.Stage
+	})
+	return comparisons
+}
+
+// summariseRun returns a summary of each host and operation in a run, notifications are not requests and are not
+// included
+func summariseRun(r *RunResults, percentiles []float64) map[string]map[OperationKey]*RunSummary {
+	window := runWindow(r.Results, r.Run)
+	summaries := make(map[string]map[OperationKey]*RunSummary)
+	for idx := range r.Results {
+		res := &r.Results[idx]
+		if res.Operation == action.NotificationOperation {
+			continue
+		}
+		if summaries[res.Hostname] == nil {
+			summaries[res.Hostname] = make(map[OperationKey]*RunSummary)
+		}
+		key := operationKey(res)
+		summary := summaries[res.Hostname][key]
+		if summary == nil {
+			summary = &RunSummary{Percentiles: make(map[float64]float64)}
+			summaries[res.Hostname][key] = summary
+		}
+		summary.Requests++
+		if res.Err != "" {
+			summary.Errors++
+		} else {
+			summary.latencies = append(summary.latencies, res.Latency)
+		}
+	}
+	for _, operations := range summaries {
+		for key, summary := range operations {
+			histogram := result.NewHistogram()
+			for _, latency := range summary.latencies {
+				histogram.Record(latency)
+			}
+			for _, p := range percentiles {
+				summary.Percentiles[p] = histogram.Percentile(p)
+			}
+			summary.TPS = measuredTPS(len(summary.latencies), stageWindow(r.TestSuite, key.Stage, window))
+			summary.ErrorRate = float64(summary.Errors) * 100 / float64(summary.Requests)
+		}
+	}
+	return summaries
+}
+
+// exceededThresholds returns a description of each threshold the candidate exceeded
+func exceededThresholds(c *Comparison, thresholds CompareThresholds) []string {
+	var exceeded []string
+	if change := percentageChange(c.Baseline.Percentiles[thresholds.Percentile], c.Candidate.Percentiles[thresholds.Percentile]); thresholds.Latency > 0 && change > thresholds.Latency {
+		exceeded = append(exceeded, fmt.Sprintf("%v +%.2f%% > %.2f%%", percentileLabel(thresholds.Percentile), change, thresholds.Latency))
+	}
+	if change := percentageChange(c.Baseline.TPS, c.Candidate.TPS); thresholds.TPS > 0 && -change > thresholds.TPS {
+		exceeded = append(exceeded, fmt.Sprintf("TPS %.2f%% < -%.2f%%", change, thresholds.TPS))
+	}
+	if change := c.Candidate.ErrorRate - c.Baseline.ErrorRate; thresholds.ErrorRate > 0 && change > thresholds.ErrorRate {
+		exceeded = append(exceeded, fmt.Sprintf("error rate +%.2f > %.2f", change, thresholds.ErrorRate))
+	}
+	if thresholds.Significant && c.Significant {
+		exceeded = append(exceeded, fmt.Sprintf("latency significantly higher p=%.4f", c.PValue))
+	}
+	return exceeded
+}
+
+// percentageChange returns the change from a baseline as a percentage of it, zero when the baseline is zero
+func percentageChange(baseline, candidate float64) float64 {
+	if baseline == 0 {
+		return 0
+	}
+	return (candidate - baseline) * 100 / baseline
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return latencyHistogram(values).Percentile(50)
+}
+
+// MannWhitney returns the two sided p-value of the Mann-Whitney U test, the probability of the samples being at
+// least as different if they came from the same distribution. The normal approximation is used, corrected for ties
+// and continuity, which is accurate for the sample sizes of a load test. Returns 1 if either sample is empty
+func MannWhitney(x, y []float64) float64 {
+	n1, n2 := float64(len(x)), float64(len(y))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	type observation struct {
+		value float64
+		first bool
+	}
+	var all []observation
+	for _, v := range x {
+		all = append(all, observation{v, true})
+	}
+	for _, v := range y {
+		all = append(all, observation{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// tied values share the mean of their ranks
+	var rankSum, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].first {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	u := rankSum - n1*(n1+1)/2
+	n := n1 + n2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := math.Max(0, math.Abs(u-n1*n2/2)-0.5) / sigma
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// ReportComparison renders a row per host and operation comparing the baseline and candidate runs, returning true if
+// any threshold was exceeded
+func ReportComparison(ts *suite.TestSuite, comparisons []Comparison, percentiles []float64, thresholds CompareThresholds) bool {
+	header := []string{"Host", "Operation"}
+	for _, p := range percentiles {
+		header = append(header, percentileLabel(p))
+	}
+	header = append(header, "TPS", "Error %", "P-Value", "Status")
+
+	exceeded := false
+	data := [][]string{}
+	for idx := range comparisons {
+		c := &comparisons[idx]
+		row := []string{c.Hostname, operationLabel(ts, c.Key)}
+		if c.Baseline == nil || c.Candidate == nil {
+			for range percentiles {
+				row = append(row, "-")
+			}
+			status := "baseline only"
+			if c.Baseline == nil {
+				status = "candidate only"
+			}
+			data = append(data, append(row, "-", "-", "-", status))
+			continue
+		}
+		for _, p := range percentiles {
+			row = append(row, compareCell(c.Baseline.Percentiles[p], c.Candidate.Percentiles[p]))
+		}
+		row = append(row, compareCell(c.Baseline.TPS, c.Candidate.TPS), fmt.Sprintf("%.2f -> %.2f", c.Baseline.ErrorRate, c.Candidate.ErrorRate), fmt.Sprintf("%.4f", c.PValue))
+		status := "ok"
+		switch {
+		case len(c.Exceeded) > 0:
+			status = strings.Join(c.Exceeded, ", ")
+			exceeded = true
+		case c.Significant:
+			status = "latency significantly higher"
+		}
+		data = append(data, append(row, status))
+	}
+	log.Println("")
+	log.Printf("Latencies of each host and operation are compared, baseline -> candidate (change), a p-value below %v indicates a significant difference\n", thresholds.Alpha)
+	var table = tablewriter.NewWriter(os.Stdout)
+	renderTable(table, header, &data)
+	table.Render()
+	if exceeded {
+		log.Printf("Candidate regressed, thresholds were exceeded\n")
+	} else {
+		log.Printf("No thresholds were exceeded\n")
+	}
+	return exceeded
+}
+
+func compareCell(baseline, candidate float64) string {
+	return fmt.Sprintf("%.2f -> %.2f (%+.2f%%)", baseline, candidate, percentageChange(baseline, candidate))
+}
+
+func init() {
+	RootCmd.AddCommand(compareCmd)
+	compareCmd.Flags().String("percentiles", "50,90,99", "latency percentiles compared, a comma separated list; for e.g. 50,99")
+	compareCmd.Flags().Float64("percentile", 99, "the latency percentile checked against the latency threshold")
+	compareCmd.Flags().Float64("latency", 0, "the maximum increase in the latency percentile as a percentage of the baseline, not checked if zero")
+	compareCmd.Flags().Float64("tps", 0, "the maximum decrease in TPS as a percentage of the baseline, not checked if zero")
+	compareCmd.Flags().Float64("error-rate", 0, "the maximum increase in the error rate in percentage points, not checked if zero")
+	compareCmd.Flags().Float64("alpha", 0.05, "the significance level of the Mann-Whitney test comparing the latencies")
+	compareCmd.Flags().Bool("significant", true, "treat significantly higher latencies as exceeding a threshold")
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_compareCmdArgs(t *testing.T) {
+	assert.Equal(t, errors.New("compare command requires a baseline and a candidate test results directory as arguments"), compareCmd.Args(myCmd, []string{"results/a"}))
+	assert.Nil(t, compareCmd.Args(myCmd, []string{"results/a", "results/b"}))
+	// a significant increase in latency fails by default
+	assert.Equal(t, "true", compareCmd.Flags().Lookup("significant").DefValue)
+}
+
+func TestMannWhitney(t *testing.T) {
+	low := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	high := []float64{11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	assert.InDelta(t, 0.000183, MannWhitney(low, high), 0.000001)
+	assert.InDelta(t, 0.000183, MannWhitney(high, low), 0.000001)
+	assert.Equal(t, 1.0, MannWhitney(low, low))
+	assert.Equal(t, 1.0, MannWhitney(low, nil))
+	// all values tied
+	assert.Equal(t, 1.0, MannWhitney([]float64{5, 5}, []float64{5, 5, 5}))
+	// overlapping samples are not significantly different
+	assert.True(t, MannWhitney([]float64{1, 3, 5, 7, 9}, []float64{2, 4, 6, 8, 10}) > 0.5)
+}
+
+// compareResults returns 100 results for a get against one host, with latencies from base and errors every nth
+func compareResults(base float64, errorEvery int) *RunResults {
+	var results []result.NetconfResult
+	for i := 0; i < 100; i++ {
+		r := result.NetconfResult{Hostname: "10.0.0.1", Operation: "get", When: float64(i * 10), Latency: base + float64(i%10)}
+		if errorEvery > 0 && i%errorEvery == 0 {
+			r.Err = "timeout"
+		}
+		results = append(results, r)
+	}
+	return &RunResults{TestSuite: &suite.TestSuite{}, Results: results}
+}
+
+func TestCompareRuns(t *testing.T) {
+	thresholds := CompareThresholds{Percentile: 99, Latency: 10, TPS: 10, ErrorRate: 1, Alpha: 0.05, Significant: true}
+
+	t.Run("no regression", func(t *testing.T) {
+		comparisons := CompareRuns(compareResults(100, 0), compareResults(100, 0), []float64{99}, thresholds)
+		assert.Len(t, comparisons, 1)
+		assert.Equal(t, 1.0, comparisons[0].PValue)
+		assert.False(t, comparisons[0].Significant)
+		assert.Empty(t, comparisons[0].Exceeded)
+	})
+	t.Run("regression", func(t *testing.T) {
+		comparisons := CompareRuns(compareResults(100, 0), compareResults(150, 10), []float64{99}, thresholds)
+		c := comparisons[0]
+		assert.True(t, c.Significant)
+		assert.Equal(t, 10, c.Candidate.Errors)
+		assert.Equal(t, 10.0, c.Candidate.ErrorRate)
+		assert.Len(t, c.Exceeded, 4)
+		assert.Contains(t, c.Exceeded[0], "P99 +")
+		assert.Equal(t, "TPS -10.00% < -10.00%", c.Exceeded[1][:len("TPS -10.00% < -10.00%")])
+	})
+	t.Run("improvement is not significant", func(t *testing.T) {
+		comparisons := CompareRuns(compareResults(150, 0), compareResults(100, 0), []float64{99}, thresholds)
+		assert.True(t, comparisons[0].PValue < 0.05)
+		assert.False(t, comparisons[0].Significant)
+		assert.Empty(t, comparisons[0].Exceeded)
+	})
+	t.Run("unmatched operations", func(t *testing.T) {
+		candidate := compareResults(100, 0)
+		candidate.Results = append(candidate.Results, result.NetconfResult{Hostname: "10.0.0.2", Operation: "get-config", When: 5, Latency: 3})
+		comparisons := CompareRuns(compareResults(100, 0), candidate, []float64{99}, thresholds)
+		assert.Len(t, comparisons, 2)
+		assert.Nil(t, comparisons[1].Baseline)
+		assert.Equal(t, "10.0.0.2", comparisons[1].Hostname)
+	})
+}
+
+func TestReportComparison(t *testing.T) {
+	thresholds := CompareThresholds{Percentile: 99, Latency: 10, Alpha: 0.05}
+	var exceeded bool
+	report := func(comparisons []Comparison) func(*cobra.Command, []string) {
+		return func(*cobra.Command, []string) {
+			exceeded = ReportComparison(&suite.TestSuite{}, comparisons, []float64{50}, thresholds)
+		}
+	}
+
+	comparisons := CompareRuns(compareResults(100, 0), compareResults(150, 0), []float64{50, 99}, thresholds)
+	stdout, logs := CaptureStdout(report(comparisons), myCmd, nil)
+	assert.True(t, exceeded)
+	assert.Contains(t, stdout, "HOST OPERATION P50 TPS ERROR % P-VALUE STATUS")
+	assert.Contains(t, stdout, "10.0.0.1 get 104.06 -> 154.11 (+48.09%) 101.01 -> 101.01 (+0.00%) 0.00 -> 0.00 0.0000 P99 +45.87% > 10.00%")
+	assert.Contains(t, logs, "Candidate regressed, thresholds were exceeded")
+
+	// a significant increase in latency fails without a latency threshold
+	thresholds = CompareThresholds{Percentile: 99, Alpha: 0.05, Significant: true}
+	comparisons = CompareRuns(compareResults(100, 0), compareResults(150, 0), []float64{50, 99}, thresholds)
+	stdout, _ = CaptureStdout(report(comparisons), myCmd, nil)
+	assert.True(t, exceeded)
+	assert.Contains(t, stdout, "0.0000 latency significantly higher")
+
+	comparisons = CompareRuns(compareResults(100, 0), compareResults(100, 0), []float64{50, 99}, thresholds)
+	stdout, logs = CaptureStdout(report(comparisons), myCmd, nil)
+	assert.False(t, exceeded)
+	assert.Contains(t, stdout, "1.0000 ok")
+	assert.Contains(t, logs, "No thresholds were exceeded")
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/damianoneill/nc-hammer/suite"
 	"github.com/spf13/cobra"
@@ -37,7 +38,7 @@ var InitCmd = &cobra.Command{
 		}
 
 		// write out TestSuite Scaffold
-		bytes, err := yaml.Marshal(BuildTestSuite(path))
+		bytes, err := TestSuiteScaffold(path)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -56,6 +57,24 @@ var InitCmd = &cobra.Command{
 	},
 }
 
+// hostKeyExample is added to the configs of the scaffold, as host keys are verified against known_hosts by default
+const hostKeyExample = `  # the agents host key is verified against $HOME/.ssh/known_hosts unless a fingerprint or a knownhosts file is
+  # defined, a host that is not in known_hosts is not connected to. insecure disables verification for lab devices
+  # fingerprint: SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8
+  # knownhosts: $HOME/lab/known_hosts
+  # insecure: true
+`
+
+// TestSuiteScaffold returns the YAML of the TestSuite scaffold, commented with the host key verification options
+func TestSuiteScaffold(path string) ([]byte, error) {
+	bytes, err := yaml.Marshal(BuildTestSuite(path))
+	if err != nil {
+		return nil, err
+	}
+	// the configs are marshalled before the blocks
+	return []byte(strings.Replace(string(bytes), "\nblocks:", "\n"+hostKeyExample+"blocks:", 1)), nil
+}
+
 // BuildTestSuite Creates TestSuite scaffold files
 func BuildTestSuite(path string) *suite.TestSuite {
 	var ts suite.TestSuite
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+)
+
+// withIntended returns a channel that forwards results to the result channel recording the time each request was
+// intended to be sent, its actual send time less the delay in starting the iteration or arrival it belongs to. The
+// returned channel is closed once the iteration or arrival has completed, then the finished channel is waited on
+func withIntended(delay time.Duration, resultChannel chan result.NetconfResult) (chan result.NetconfResult, chan bool) {
+	intended := make(chan result.NetconfResult)
+	intendedFinished := make(chan bool)
+	go func() {
+		for r := range intended {
+			r.Intended = r.Sent - float64(delay.Nanoseconds())/float64(time.Millisecond)
+			resultChannel <- r
+		}
+		intendedFinished <- true
+	}()
+	return intended, intendedFinished
+}
+
+// executeIntended runs an iteration or arrival that was intended to start at a time, waiting until then if early,
+// so that results record when their requests were intended to be sent
+func executeIntended(intended time.Time, resultChannel chan result.NetconfResult, execute func(chan result.NetconfResult)) {
+	// sleeping for a negative duration returns immediately, a late start is recorded as the delay
+	time.Sleep(time.Until(intended))
+	delay := time.Since(intended)
+	if delay < 0 {
+		delay = 0
+	}
+	results, resultsFinished := withIntended(delay, resultChannel)
+	execute(results)
+	close(results)
+	<-resultsFinished
+}
+
+// pacedIteration runs a clients iteration, when the suite defines a pacing iterations are intended to start at
+// that interval from the clients first iteration rather than as soon as the previous iteration completes. The wait
+// for a paced iteration ends when stop is closed, the iteration is then not run. Returns whether the iteration ran
+func pacedIteration(start, clientStart time.Time, iteration int, ts *suite.TestSuite, cID int, stop <-chan bool, resultChannel chan result.NetconfResult) bool {
+	if ts.Pacing <= 0 {
+		executeBlocks(start, ts, cID, resultChannel)
+		return true
+	}
+	intended := clientStart.Add(time.Duration(iteration*ts.Pacing) * time.Millisecond)
+	if !waitUntil(intended, stop) {
+		return false
+	}
+	executeIntended(intended, resultChannel, func(results chan result.NetconfResult) {
+		executeBlocks(start, ts, cID, results)
+	})
+	return true
+}
+
+// waitUntil waits until a time or until stop is closed, a nil stop channel is never closed. Returns false when
+// stopped
+func waitUntil(until time.Time, stop <-chan bool) bool {
+	wait := time.Until(until)
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
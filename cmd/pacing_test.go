@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_withIntended(t *testing.T) {
+	resultChannel := make(chan result.NetconfResult, 1)
+	intended, intendedFinished := withIntended(25*time.Millisecond, resultChannel)
+	intended <- result.NetconfResult{Operation: "get", Sent: 100}
+	close(intended)
+	<-intendedFinished
+	assert.Equal(t, 75.0, (<-resultChannel).Intended)
+}
+
+func Test_executeIntended(t *testing.T) {
+	resultChannel := make(chan result.NetconfResult, 1)
+	send := func(results chan result.NetconfResult) {
+		results <- result.NetconfResult{Operation: "get", Sent: 1000}
+	}
+
+	t.Run("late start", func(t *testing.T) {
+		executeIntended(time.Now().Add(-200*time.Millisecond), resultChannel, send)
+		r := <-resultChannel
+		assert.True(t, r.Intended <= 800 && r.Intended > 700, "intended %v", r.Intended)
+	})
+	t.Run("early start waits", func(t *testing.T) {
+		begin := time.Now()
+		executeIntended(begin.Add(50*time.Millisecond), resultChannel, send)
+		assert.True(t, time.Since(begin) >= 50*time.Millisecond)
+		r := <-resultChannel
+		assert.True(t, r.Intended <= 1000 && r.Intended > 990, "intended %v", r.Intended)
+	})
+}
+
+func Test_pacedIteration(t *testing.T) {
+	sleep := suite.Block{Type: "sequential", Actions: []suite.Action{{Sleep: &suite.Sleep{Duration: 10}}}}
+	resultChannel := make(chan result.NetconfResult)
+
+	t.Run("paced", func(t *testing.T) {
+		ts := &suite.TestSuite{Iterations: 5, Pacing: 50, Blocks: []suite.Block{sleep}}
+		begin := time.Now()
+		handleBlocks(time.Now(), time.Time{}, ts, 0, resultChannel)
+		// the fifth iteration is intended to start 200ms after the first
+		assert.True(t, time.Since(begin) >= 200*time.Millisecond)
+	})
+	t.Run("deadline ends the wait for pacing", func(t *testing.T) {
+		ts := &suite.TestSuite{Duration: 1, Pacing: 10000, Blocks: []suite.Block{sleep}}
+		begin := time.Now()
+		completed := handleBlocks(time.Now(), begin.Add(100*time.Millisecond), ts, 0, resultChannel)
+		assert.Equal(t, 1, completed)
+		assert.True(t, time.Since(begin) < time.Second)
+	})
+	t.Run("stopped", func(t *testing.T) {
+		ts := &suite.TestSuite{Pacing: 10000, Blocks: []suite.Block{sleep}}
+		stop := make(chan bool)
+		close(stop)
+		begin := time.Now()
+		assert.False(t, pacedIteration(begin, begin, 1, ts, 0, stop, resultChannel))
+		assert.True(t, time.Since(begin) < time.Second)
+		// an iteration that is due is run
+		assert.True(t, pacedIteration(begin, begin, 0, ts, 0, stop, resultChannel))
+	})
+	t.Run("not paced", func(t *testing.T) {
+		ts := &suite.TestSuite{Iterations: 5, Blocks: []suite.Block{sleep}}
+		begin := time.Now()
+		handleBlocks(time.Now(), time.Time{}, ts, 0, resultChannel)
+		assert.True(t, time.Since(begin) < 200*time.Millisecond)
+	})
+}
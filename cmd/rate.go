@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/action"
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+)
+
+// arrival is a unit of work scheduled by an open model load, executed by a worker using its id as the client id
+type arrival func(cID int, resultChannel chan result.NetconfResult)
+
+// scheduled is an arrival and the time it was intended to start
+type scheduled struct {
+	arrival  arrival
+	intended time.Time
+}
+
+// dispatcher hands arrivals to idle workers, a worker is added when none are idle up to the maximum after which the
+// arrival waits for a worker to become free. Results record the time each arrival was intended to start so that
+// latency can be corrected for the time spent waiting
+type dispatcher struct {
+	arrivals      []arrival
+	maxWorkers    int
+	resultChannel chan result.NetconfResult
+	work          chan scheduled
+	workerWg      sync.WaitGroup
+	workers       int
+	dispatched    int
+	completed     int64
+	started       time.Time
+}
+
+func newDispatcher(arrivals []arrival, maxWorkers int, resultChannel chan result.NetconfResult) *dispatcher {
+	return &dispatcher{arrivals: arrivals, maxWorkers: maxWorkers, resultChannel: resultChannel, work: make(chan scheduled), started: time.Now()}
+}
+
+// dispatch hands the next arrival, intended to start at a time, to a worker
+func (d *dispatcher) dispatch(intended time.Time) {
+	s := scheduled{arrival: d.arrivals[d.dispatched%len(d.arrivals)], intended: intended}
+	d.dispatched++
+	select {
+	case d.work <- s:
+	default:
+		if d.workers < d.maxWorkers {
+			d.workerWg.Add(1)
+			go func(cID int) {
+				defer d.workerWg.Done()
+				for s := range d.work {
+					executeIntended(s.intended, d.resultChannel, func(results chan result.NetconfResult) {
+						s.arrival(cID, results)
+					})
+					atomic.AddInt64(&d.completed, 1)
+				}
+			}(d.workers)
+			d.workers++
+		}
+		d.work <- s
+	}
+}
+
+// finish waits for the workers to complete the arrivals in flight, recording the rate achieved in the run information
+func (d *dispatcher) finish(run *result.RunInfo, unit string) {
+	close(d.work)
+	d.workerWg.Wait()
+	elapsed := time.Since(d.started)
+
+	run.RateUnit = unit
+	run.Arrivals = int(d.completed)
+	run.Workers = d.workers
+	if elapsed > 0 {
+		run.AchievedRate = float64(d.completed) / elapsed.Seconds()
+	}
+	run.Iterations = run.Arrivals / len(d.arrivals)
+}
+
+// runRate runs an open model load, arrivals are scheduled at the suites target rate until the iterations or the
+// deadline is reached. The arrivals completed, the rate achieved and why the run stopped are recorded in the run
+// information
+func runRate(start, deadline time.Time, ts *suite.TestSuite, resultChannel chan result.NetconfResult, run *result.RunInfo) {
+	rate := ts.Rate
+	log.Printf(" > Open model, target rate %.2f %v(s) per second, up to %d workers\n", rate.Target, rate.GetUnit(), rate.GetMaxWorkers())
+
+	arrivals := newArrivals(start, ts, rate.GetUnit())
+	if len(arrivals) == 0 {
+		run.StopReason = result.StopReasonIterations
+		return
+	}
+	// zero is unlimited, validation ensures there is a deadline in that case
+	limit := ts.Iterations * len(arrivals)
+	interval := time.Duration(float64(time.Second) / rate.Target)
+
+	d := newDispatcher(arrivals, rate.GetMaxWorkers(), resultChannel)
+	for limit == 0 || d.dispatched < limit {
+		next := d.started.Add(time.Duration(d.dispatched) * interval)
+		if !deadline.IsZero() && !next.Before(deadline) {
+			break
+		}
+		// sleeping for a negative duration returns immediately, arrivals that are behind schedule are sent at once
+		time.Sleep(time.Until(next))
+		d.dispatch(next)
+	}
+	d.finish(run, rate.GetUnit())
+
+	run.TargetRate = rate.Target
+	run.StopReason = result.StopReasonDuration
+	if limit > 0 && d.dispatched == limit {
+		run.StopReason = result.StopReasonIterations
+	}
+}
+
+// newArrivals returns the arrivals that make up an iteration of the suite, a single arrival executing the blocks or,
+// with unit rpc, an arrival per netconf action (sleep actions are not scheduled)
+func newArrivals(start time.Time, ts *suite.TestSuite, unit string) []arrival {
+	if unit != suite.RateUnitRPC {
+		return []arrival{func(cID int, resultChannel chan result.NetconfResult) { executeBlocks(start, ts, cID, resultChannel) }}
+	}
+	var arrivals []arrival
+	for _, block := range ts.Blocks {
+		if block.Type == "init" {
+			continue
+		}
+		for _, a := range block.Actions {
+			if a.Netconf == nil {
+				continue
+			}
+			a := a
+			arrivals = append(arrivals, func(cID int, resultChannel chan result.NetconfResult) {
+				action.Execute(start, cID, ts, a, resultChannel)
+			})
+		}
+	}
+	return arrivals
+}
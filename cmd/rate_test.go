@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_runRate(t *testing.T) {
+	sleep := suite.Block{Type: "sequential", Actions: []suite.Action{{Sleep: &suite.Sleep{Duration: 50}}}}
+	resultChannel := make(chan result.NetconfResult)
+
+	t.Run("iterations reached", func(t *testing.T) {
+		ts := &suite.TestSuite{Iterations: 10, Rate: &suite.Rate{Target: 100}, Blocks: []suite.Block{sleep}}
+		run := &result.RunInfo{}
+		runRate(time.Now(), time.Time{}, ts, resultChannel, run)
+		assert.Equal(t, 10, run.Arrivals)
+		assert.Equal(t, 10, run.Iterations)
+		assert.Equal(t, result.StopReasonIterations, run.StopReason)
+		assert.Equal(t, suite.RateUnitIteration, run.RateUnit)
+		assert.Equal(t, 100.0, run.TargetRate)
+		// each arrival takes longer than the interval so workers are added rather than the rate dropping
+		assert.True(t, run.Workers > 1 && run.Workers <= 10)
+		assert.True(t, run.AchievedRate > 50)
+	})
+	t.Run("duration reached", func(t *testing.T) {
+		ts := &suite.TestSuite{Rate: &suite.Rate{Target: 50}, Blocks: []suite.Block{sleep}}
+		run := &result.RunInfo{}
+		runRate(time.Now(), time.Now().Add(200*time.Millisecond), ts, resultChannel, run)
+		assert.True(t, run.Arrivals >= 9 && run.Arrivals <= 11)
+		assert.Equal(t, result.StopReasonDuration, run.StopReason)
+	})
+	t.Run("workers limited", func(t *testing.T) {
+		ts := &suite.TestSuite{Iterations: 6, Rate: &suite.Rate{Target: 1000, MaxWorkers: 2}, Blocks: []suite.Block{sleep}}
+		run := &result.RunInfo{}
+		begin := time.Now()
+		runRate(time.Now(), time.Time{}, ts, resultChannel, run)
+		assert.Equal(t, 2, run.Workers)
+		assert.Equal(t, 6, run.Arrivals)
+		assert.True(t, time.Since(begin) >= 150*time.Millisecond)
+	})
+	t.Run("rpc unit does not schedule sleeps", func(t *testing.T) {
+		ts := &suite.TestSuite{Iterations: 5, Rate: &suite.Rate{Target: 100, Unit: suite.RateUnitRPC}, Blocks: []suite.Block{sleep}}
+		run := &result.RunInfo{}
+		runRate(time.Now(), time.Time{}, ts, resultChannel, run)
+		assert.Equal(t, 0, run.Arrivals)
+	})
+}
+
+func Test_newArrivals(t *testing.T) {
+	get := "get"
+	netconf := suite.Action{Netconf: &suite.Netconf{Hostname: "10.0.0.1", Operation: &get}}
+	sleep := suite.Action{Sleep: &suite.Sleep{Duration: 10}}
+	blocks := []suite.Block{
+		{Type: "init", Actions: []suite.Action{netconf}},
+		{Type: "sequential", Actions: []suite.Action{netconf, sleep, netconf}},
+		{Type: "concurrent", Actions: []suite.Action{netconf}},
+	}
+	ts := &suite.TestSuite{Rate: &suite.Rate{Target: 1}, Blocks: blocks}
+	assert.Len(t, newArrivals(time.Now(), ts, suite.RateUnitIteration), 1)
+	assert.Len(t, newArrivals(time.Now(), ts, suite.RateUnitRPC), 3)
+}
@@ -0,0 +1,438 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/action"
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/spf13/cobra"
+	"gonum.org/v1/gonum/stat"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report <results directory>",
+	Short: "Generate a HTML report of a Test Suite run",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("report command requires a test results directory as an argument")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		results, ts, err := result.UnarchiveResults(args[0])
+		if err != nil {
+			log.Fatalf("Problem with loading result information: %v ", err)
+		}
+		run, err := result.UnarchiveRunInfo(args[0])
+		if err != nil {
+			log.Fatalf("Problem with loading run information: %v ", err)
+		}
+		//nolint
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			output = filepath.Join(args[0], "report.html")
+		}
+		//nolint
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if interval <= 0 {
+			log.Fatalf("Problem with interval flag: interval must be greater than zero ")
+		}
+
+		file, err := os.Create(output)
+		if err != nil {
+			log.Fatalf("Problem with creating the report: %v ", err)
+		}
+		// nolint
+		defer file.Close()
+		if err = WriteReport(file, ts, results, run, interval); err != nil {
+			log.Fatalf("Problem with writing the report: %v ", err)
+		}
+		log.Printf("Report written to %v\n", output)
+	},
+}
+
+// reportPercentiles are the latency percentiles shown in the reports summary
+var reportPercentiles = []float64{50, 90, 99}
+
+// report is the data rendered by the report template
+type report struct {
+	Title      string
+	Overview   [][]string
+	Histogram  template.HTML
+	Timeline   template.HTML
+	Summary    [][]string
+	SummaryFor []string
+	Errors     [][]string
+	Suite      string
+}
+
+// WriteReport writes a self contained HTML report of a run, charts are inline SVG so the report can be viewed
+// offline. Throughput and the error rate are charted over intervals of the run
+func WriteReport(w io.Writer, ts *suite.TestSuite, results []result.NetconfResult, run *result.RunInfo, interval time.Duration) error {
+	suiteYAML, err := redactedSuite(ts)
+	if err != nil {
+		return err
+	}
+
+	latencies := make(map[string]map[OperationKey][]float64)
+	errCount := OrderAndExcludeErrValues(results, latencies)
+
+	var successful []float64
+	for idx := range results {
+		if results[idx].Err == "" && results[idx].Operation != action.NotificationOperation {
+			successful = append(successful, results[idx].Latency)
+		}
+	}
+	window := runWindow(results, run)
+
+	r := report{
+		Title:    "nc-hammer report, " + filepath.Base(filepath.Dir(ts.File)),
+		Overview: reportOverview(ts, results, run, window, errCount),
+		Errors:   reportErrors(results),
+		Suite:    suiteYAML,
+	}
+	// the charts are generated from numbers and escaped text only
+	// #nosec
+	r.Histogram, r.Timeline = template.HTML(histogramSVG(successful)), template.HTML(timelineSVG(Timeline(results, interval, nil, "", ""), interval))
+	corrected, showCorrected := CorrectedLatencies(results)
+	r.SummaryFor, r.Summary = reportSummary(ts, latencies, corrected, showCorrected, window)
+	return reportTemplate.Execute(w, r)
+}
+
+// redacted replaces the secrets of the configs in the suite shown in a report
+const redacted = "********"
+
+// redactedSuite returns the suite, with any xml inlined, as YAML with the passwords, passphrases and keyboard
+// interactive answers of its configs redacted, the report is intended to be shared
+func redactedSuite(ts *suite.TestSuite) (string, error) {
+	copied := *ts
+	copied.Configs = make(suite.Configs, len(ts.Configs))
+	copy(copied.Configs, ts.Configs)
+	for idx := range copied.Configs {
+		config := &copied.Configs[idx]
+		if config.Password != "" {
+			config.Password = redacted
+		}
+		if config.Passphrase != "" {
+			config.Passphrase = redacted
+		}
+		if len(config.KeyboardInteractive) > 0 {
+			answers := make([]string, len(config.KeyboardInteractive))
+			for i := range answers {
+				answers[i] = redacted
+			}
+			config.KeyboardInteractive = answers
+		}
+	}
+	bytes, err := yaml.Marshal(&copied)
+	return string(bytes), err
+}
+
+// reportOverview returns the name and value of the facts about the run shown at the top of the report
+func reportOverview(ts *suite.TestSuite, results []result.NetconfResult, run *result.RunInfo, window time.Duration, errCount int) [][]string {
+	var hosts []string
+	for idx := range ts.Configs {
+		hosts = append(hosts, ts.Configs[idx].Hostname)
+	}
+	overview := [][]string{
+		{"Hosts", strings.Join(hosts, ", ")},
+		{"Clients", strconv.Itoa(ts.Clients)},
+		{"Iterations per client", strconv.Itoa(ts.Iterations)},
+		{"Execution time", window.Round(time.Millisecond).String()},
+		{"Results", strconv.Itoa(len(results))},
+		{"Errors", strconv.Itoa(errCount)},
+	}
+	if run != nil {
+		overview = append(overview, []string{"Started", run.Started.Format("Mon Jan _2 15:04:05 2006")}, []string{"Stopped by", run.StopReason + " limit"})
+		if run.TargetRate > 0 {
+			overview = append(overview, []string{"Rate", fmt.Sprintf("target %.2f, achieved %.2f %v(s) per second", run.TargetRate, run.AchievedRate, run.RateUnit)})
+		}
+	}
+	return overview
+}
+
+// reportSummary returns the header and a row per host and operation summarising the successful requests, with the
+// corrected percentiles when requests were paced or scheduled at a rate
+func reportSummary(ts *suite.TestSuite, latencies map[string]map[OperationKey][]float64, corrected map[string]map[OperationKey][]float64,
+	showCorrected bool, window time.Duration) ([]string, [][]string) {
+	header := []string{"Host", "Operation", "Requests", "TPS", "Mean", "Min", "Max"}
+	for _, p := range reportPercentiles {
+		header = append(header, percentileLabel(p))
+	}
+	if showCorrected {
+		for _, p := range reportPercentiles {
+			header = append(header, "Corrected "+percentileLabel(p))
+		}
+	}
+	var rows [][]string
+	for _, host := range SortLatencies(latencies) {
+		for _, key := range SortOperations(latencies[host]) {
+			values := latencies[host][key]
+			if len(values) == 0 {
+				continue
+			}
+			histogram := latencyHistogram(values)
+			row := []string{host, operationLabel(ts, key), strconv.Itoa(len(values)), fmt.Sprintf("%.2f", measuredTPS(len(values), stageWindow(ts, key.Stage, window))),
+				fmt.Sprintf("%.2f", stat.Mean(values, nil)), fmt.Sprintf("%.2f", histogram.Min()), fmt.Sprintf("%.2f", histogram.Max())}
+			for _, p := range reportPercentiles {
+				row = append(row, fmt.Sprintf("%.2f", histogram.Percentile(p)))
+			}
+			if showCorrected {
+				correctedHistogram := latencyHistogram(corrected[host][key])
+				for _, p := range reportPercentiles {
+					row = append(row, fmt.Sprintf("%.2f", correctedHistogram.Percentile(p)))
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return header, rows
+}
+
+// operationLabel returns an operation qualified by its datastore, with-defaults mode and stage when set
+func operationLabel(ts *suite.TestSuite, key OperationKey) string {
+	var qualifiers []string
+	if key.Datastore != "" {
+		qualifiers = append(qualifiers, key.Datastore)
+	}
+	if key.WithDefaults != "" {
+		qualifiers = append(qualifiers, key.WithDefaults)
+	}
+	if key.Stage != 0 {
+		qualifiers = append(qualifiers, "stage "+ts.StageLabel(key.Stage))
+	}
+	if len(qualifiers) == 0 {
+		return key.Operation
+	}
+	return key.Operation + " (" + strings.Join(qualifiers, ", ") + ")"
+}
+
+// reportErrors returns a row per distinct error for each host and operation with its category and count, the most
+// frequent first
+func reportErrors(results []result.NetconfResult) [][]string {
+	type errorKey struct {
+		hostname, operation, err string
+	}
+	counts := make(map[errorKey]int)
+	// the results with the same error are categorised the same, so the first is kept to categorise them by
+	firsts := make(map[errorKey]*result.NetconfResult)
+	for idx := range results {
+		if results[idx].Err != "" {
+			key := errorKey{results[idx].Hostname, results[idx].Operation, results[idx].Err}
+			if counts[key] == 0 {
+				firsts[key] = &results[idx]
+			}
+			counts[key]++
+		}
+	}
+	var keys []errorKey
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		if keys[i].hostname != keys[j].hostname {
+			return keys[i].hostname < keys[j].hostname
+		}
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		return keys[i].err < keys[j].err
+	})
+	var rows [][]string
+	for _, key := range keys {
+		rows = append(rows, []string{ErrorCategory(firsts[key]), key.hostname, key.operation, key.err, strconv.Itoa(counts[key])})
+	}
+	return rows
+}
+
+// chart dimensions, the plot area is inset by the margin to leave room for the axis labels
+const (
+	chartWidth    = 800
+	chartHeight   = 300
+	chartMargin   = 50
+	histogramBins = 40
+)
+
+// histogramSVG returns a bar chart of the distribution of the latencies, empty without latencies
+func histogramSVG(latencies []float64) string {
+	if len(latencies) == 0 {
+		return ""
+	}
+	min, max := latencies[0], latencies[0]
+	for _, latency := range latencies {
+		min, max = math.Min(min, latency), math.Max(max, latency)
+	}
+	width := (max - min) / histogramBins
+	counts := make([]int, histogramBins)
+	for _, latency := range latencies {
+		bin := histogramBins - 1
+		if width > 0 {
+			bin = int(math.Min(float64(histogramBins-1), (latency-min)/width))
+		}
+		counts[bin]++
+	}
+	highest := 0
+	for _, count := range counts {
+		if count > highest {
+			highest = count
+		}
+	}
+
+	var svg strings.Builder
+	openChart(&svg, "Latency distribution")
+	plotWidth, plotHeight := float64(chartWidth-2*chartMargin), float64(chartHeight-2*chartMargin)
+	barWidth := plotWidth / histogramBins
+	for bin, count := range counts {
+		height := plotHeight * float64(count) / float64(highest)
+		fmt.Fprintf(&svg, `<rect class="bar" x="%.1f" y="%.1f" width="%.1f" height="%.1f"><title>%.2f - %.2f ms: %d</title></rect>`,
+			chartMargin+float64(bin)*barWidth, chartMargin+plotHeight-height, barWidth-1, height, min+float64(bin)*width, min+float64(bin+1)*width, count)
+	}
+	closeChart(&svg, fmt.Sprintf("%.2f ms", min), fmt.Sprintf("%.2f ms", max), strconv.Itoa(highest)+" requests", "")
+	return svg.String()
+}
+
+// timelineSVG returns a line chart of the throughput and error rate in each interval across all hosts and operations,
+// empty without any requests
+func timelineSVG(rows []TimelineRow, interval time.Duration) string {
+	requests := make(map[float64]int)
+	errs := make(map[float64]int)
+	var starts []float64
+	for _, row := range rows {
+		if _, present := requests[row.Start]; !present {
+			starts = append(starts, row.Start)
+		}
+		requests[row.Start] += row.Requests
+		errs[row.Start] += row.Errors
+	}
+	if len(starts) == 0 {
+		return ""
+	}
+	sort.Float64s(starts)
+
+	tps := make([]float64, len(starts))
+	errorRates := make([]float64, len(starts))
+	highest := 0.0
+	for idx, start := range starts {
+		tps[idx] = float64(requests[start]) / interval.Seconds()
+		if requests[start] > 0 {
+			errorRates[idx] = float64(errs[start]) * 100 / float64(requests[start])
+		}
+		highest = math.Max(highest, tps[idx])
+	}
+	if highest == 0 {
+		highest = 1
+	}
+
+	var svg strings.Builder
+	openChart(&svg, "Throughput and error rate")
+	plotWidth, plotHeight := float64(chartWidth-2*chartMargin), float64(chartHeight-2*chartMargin)
+	step := plotWidth
+	if len(starts) > 1 {
+		step = plotWidth / float64(len(starts)-1)
+	}
+	points := func(values []float64, scale float64) string {
+		var p []string
+		for idx, value := range values {
+			p = append(p, fmt.Sprintf("%.1f,%.1f", chartMargin+float64(idx)*step, chartMargin+plotHeight-plotHeight*value/scale))
+		}
+		return strings.Join(p, " ")
+	}
+	fmt.Fprintf(&svg, `<polyline class="tps" points="%v"/>`, points(tps, highest))
+	fmt.Fprintf(&svg, `<polyline class="errors" points="%v"/>`, points(errorRates, 100))
+	last := time.Duration(starts[len(starts)-1] * float64(time.Second))
+	closeChart(&svg, "0s", last.String(), fmt.Sprintf("%.2f TPS", highest), "100% errors")
+	return svg.String()
+}
+
+func openChart(svg *strings.Builder, title string) {
+	fmt.Fprintf(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img"><title>%v</title>`,
+		chartWidth, chartHeight, chartWidth, chartHeight, html.EscapeString(title))
+}
+
+// closeChart draws the axes labelled with the range of the x axis and the highest values of the left and right axes
+func closeChart(svg *strings.Builder, xMin, xMax, yLeft, yRight string) {
+	bottom, right := chartHeight-chartMargin, chartWidth-chartMargin
+	fmt.Fprintf(svg, `<line class="axis" x1="%d" y1="%d" x2="%d" y2="%d"/>`, chartMargin, bottom, right, bottom)
+	fmt.Fprintf(svg, `<line class="axis" x1="%d" y1="%d" x2="%d" y2="%d"/>`, chartMargin, chartMargin, chartMargin, bottom)
+	fmt.Fprintf(svg, `<text x="%d" y="%d">%v</text>`, chartMargin, bottom+20, html.EscapeString(xMin))
+	fmt.Fprintf(svg, `<text x="%d" y="%d" text-anchor="end">%v</text>`, right, bottom+20, html.EscapeString(xMax))
+	fmt.Fprintf(svg, `<text x="%d" y="%d">%v</text>`, chartMargin, chartMargin-10, html.EscapeString(yLeft))
+	if yRight != "" {
+		fmt.Fprintf(svg, `<text class="errors-label" x="%d" y="%d" text-anchor="end">%v</text>`, right, chartMargin-10, html.EscapeString(yRight))
+	}
+	svg.WriteString(`</svg>`)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+pre { background: #f7f7f7; padding: 1em; overflow-x: auto; }
+svg text { font-size: 12px; fill: #444; }
+.bar { fill: #4a7ab5; }
+.axis { stroke: #444; }
+.tps { fill: none; stroke: #4a7ab5; stroke-width: 2; }
+.errors { fill: none; stroke: #c0392b; stroke-width: 2; }
+.errors-label { fill: #c0392b; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<table>
+{{range .Overview}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+
+<h2>Summary</h2>
+<p>Latencies are in milliseconds and exclude errors.</p>
+<table>
+<tr>{{range .SummaryFor}}<th>{{.}}</th>{{end}}</tr>
+{{range .Summary}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+
+<h2>Latency Distribution</h2>
+{{if .Histogram}}{{.Histogram}}{{else}}<p>No successful requests.</p>{{end}}
+
+<h2>Throughput and Error Rate</h2>
+{{if .Timeline}}{{.Timeline}}{{else}}<p>No requests.</p>{{end}}
+
+<h2>Errors</h2>
+{{if .Errors}}<table>
+<tr><th>Category</th><th>Host</th><th>Operation</th><th>Error</th><th>Count</th></tr>
+{{range .Errors}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>{{else}}<p>No errors.</p>{{end}}
+
+<h2>Test Suite</h2>
+<pre>{{.Suite}}</pre>
+</body>
+</html>
+`))
+
+func init() {
+	RootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().String("output", "", "the file the report is written to, defaults to report.html in the results directory")
+	reportCmd.Flags().Duration("interval", 10*time.Second, "the interval throughput and the error rate are charted over, for e.g. 10s or 1m")
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteReport(t *testing.T) {
+	results, ts, err := result.UnarchiveResults("../suite/testdata/results_test/2018-07-18-19-56-01/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	assert.Nil(t, WriteReport(&out, ts, results, nil, time.Second))
+	report := out.String()
+
+	assert.Contains(t, report, "<title>nc-hammer report, 2018-07-18-19-56-01</title>")
+	assert.Contains(t, report, "<th>Host</th><th>Operation</th><th>Requests</th><th>TPS</th><th>Mean</th><th>Min</th><th>Max</th><th>P50</th><th>P90</th><th>P99</th>")
+	assert.Contains(t, report, "<td>172.26.138.91</td><td>get</td>")
+	assert.Contains(t, report, `<polyline class="tps"`)
+	assert.Contains(t, report, `<rect class="bar"`)
+	assert.Contains(t, report, "<td>Other</td><td>172.26.138.91</td><td>kill-session</td><td>kill-session is not a supported operation</td>")
+	// the suite is inlined, escaped
+	assert.Contains(t, report, "<h2>Test Suite</h2>\n<pre>iterations:")
+	assert.False(t, strings.Contains(report, "<script"), "the report should not depend on scripts")
+	// secrets of the configs are redacted
+	assert.Contains(t, report, "password: &#39;********&#39;")
+	assert.NotContains(t, report, "password: pass")
+}
+
+func Test_redactedSuite(t *testing.T) {
+	ts := &suite.TestSuite{Configs: suite.Configs{
+		{Hostname: "10.0.0.1", Username: "admin", Password: "pw-secret", PrivateKey: "id_rsa", Passphrase: "pp-secret", KeyboardInteractive: []string{"ki-secret"}},
+		{Hostname: "10.0.0.2", Username: "admin", Agent: "$SSH_AUTH_SOCK"},
+	}}
+	s, err := redactedSuite(ts)
+	assert.Nil(t, err)
+	for _, secret := range []string{"pw-secret", "pp-secret", "ki-secret"} {
+		assert.NotContains(t, s, secret)
+	}
+	assert.Contains(t, s, "privatekey: id_rsa")
+	assert.Contains(t, s, "password: \"\"\n")
+	// the suite itself is unchanged
+	assert.Equal(t, "pw-secret", ts.Configs[0].Password)
+	assert.Equal(t, []string{"ki-secret"}, ts.Configs[0].KeyboardInteractive)
+}
+
+func Test_reportSummaryCorrected(t *testing.T) {
+	results := []result.NetconfResult{
+		{Hostname: "10.0.0.1", Operation: "get", Latency: 10, Sent: 90, Intended: 90},
+		{Hostname: "10.0.0.1", Operation: "get", Latency: 10, Sent: 190, Intended: 160},
+	}
+	latencies := make(map[string]map[OperationKey][]float64)
+	OrderAndExcludeErrValues(results, latencies)
+	corrected, showCorrected := CorrectedLatencies(results)
+	header, rows := reportSummary(&suite.TestSuite{}, latencies, corrected, showCorrected, time.Second)
+	assert.Equal(t, []string{"Host", "Operation", "Requests", "TPS", "Mean", "Min", "Max", "P50", "P90", "P99", "Corrected P50", "Corrected P90", "Corrected P99"}, header)
+	assert.Equal(t, []string{"40.00", "40.00"}, rows[0][len(rows[0])-2:])
+
+	header, _ = reportSummary(&suite.TestSuite{}, latencies, corrected, false, time.Second)
+	assert.Equal(t, "P99", header[len(header)-1])
+}
+
+func Test_histogramSVG(t *testing.T) {
+	assert.Equal(t, "", histogramSVG(nil))
+
+	svg := histogramSVG([]float64{10, 10, 20, 30})
+	assert.Equal(t, histogramBins, strings.Count(svg, `<rect class="bar"`))
+	assert.Contains(t, svg, "<title>10.00 - 10.50 ms: 2</title>")
+	assert.Contains(t, svg, "<title>29.50 - 30.00 ms: 1</title>")
+	assert.Contains(t, svg, ">2 requests</text>")
+
+	// a single latency is placed in the last bin
+	assert.Contains(t, histogramSVG([]float64{5}), "<title>5.00 - 5.00 ms: 1</title>")
+}
+
+func Test_timelineSVG(t *testing.T) {
+	assert.Equal(t, "", timelineSVG(nil, time.Second))
+
+	rows := Timeline(timelineResults, time.Second, nil, "", "")
+	svg := timelineSVG(rows, time.Second)
+	assert.Contains(t, svg, `<polyline class="tps" points="50.0,50.0 283.3,50.0 516.7,250.0 750.0,150.0"/>`)
+	assert.Contains(t, svg, `<polyline class="errors" points="50.0,250.0 283.3,150.0 516.7,250.0 750.0,250.0"/>`)
+	assert.Contains(t, svg, ">3s</text>")
+}
+
+func Test_reportErrors(t *testing.T) {
+	results := []result.NetconfResult{
+		{Hostname: "10.0.0.2", Operation: "get", Err: "dial tcp 10.0.0.2:830: i/o timeout"},
+		{Hostname: "10.0.0.1", Operation: "get", Err: "session closed by remote side"},
+		{Hostname: "10.0.0.2", Operation: "get", Err: "dial tcp 10.0.0.2:830: i/o timeout"},
+		{Hostname: "10.0.0.1", Operation: "get"},
+	}
+	assert.Equal(t, [][]string{
+		{CategoryTimeout, "10.0.0.2", "get", "dial tcp 10.0.0.2:830: i/o timeout", "2"},
+		{CategorySessionClosed, "10.0.0.1", "get", "session closed by remote side", "1"},
+	}, reportErrors(results))
+}
+
+func Test_ReportCmdArgs(t *testing.T) {
+	assert.Equal(t, errors.New("report command requires a test results directory as an argument"), reportCmd.Args(myCmd, []string{}))
+	assert.Nil(t, reportCmd.Args(myCmd, []string{"../results/2018-07-18-19-56-01/"}))
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"errors"
 	"log"
+	"math"
 	"sync"
 	"time"
 
@@ -26,20 +27,33 @@ var runCmd = &cobra.Command{
 		if ts, err := suite.NewTestSuite(args[0]); err != nil {
 			log.Fatalf("Problem with YAML file: %v ", err)
 		} else {
+			//nolint
+			if duration, _ := cmd.Flags().GetDuration("duration"); duration > 0 {
+				ts.Duration = int(math.Ceil(duration.Seconds()))
+			}
 			runTestSuite(ts)
 		}
 	},
 }
 
-func runTestSuite(ts *suite.TestSuite) {
+// runTestSuite executes a Test Suite, returning the directory the results were archived to
+func runTestSuite(ts *suite.TestSuite) string {
 	start := time.Now()
 	log.Printf("Testsuite %v started at %v\n", ts.File, start.Format("Mon Jan _2 15:04:05 2006"))
 	log.Printf(" > %d client(s), %d iterations per client, %d seconds wait between starting each client\n", ts.Clients, ts.Iterations, ts.Rampup)
 
+	// a zero deadline indicates the run is limited by iterations only
+	var deadline time.Time
+	if ts.Duration > 0 {
+		deadline = start.Add(time.Duration(ts.Duration) * time.Second)
+		log.Printf(" > Duration %v, the run stops when the iterations or the duration is reached, in flight iterations are completed\n", time.Duration(ts.Duration)*time.Second)
+	}
+
 	// handle results in separate goroutine
 	resultChannel := make(chan result.NetconfResult)
-	handleResultsFinished := make(chan bool)
-	go result.HandleResults(resultChannel, handleResultsFinished, ts)
+	handleResultsFinished := make(chan string)
+	run := &result.RunInfo{Started: start}
+	go result.HandleResults(resultChannel, handleResultsFinished, ts, run)
 
 	// check first for an init block, this runs at the start, actions are sequential, it only runs once
 	// if the tester has specified more than one init block, these are ignored
@@ -49,56 +63,106 @@ func runTestSuite(ts *suite.TestSuite) {
 			action.Execute(start, 0, ts, a, resultChannel)
 		}
 	}
+
+	switch {
+	case len(ts.Stages) > 0:
+		runStages(start, ts, resultChannel, run)
+	case ts.Rate != nil:
+		runRate(start, deadline, ts, resultChannel, run)
+	default:
+		runClients(start, deadline, ts, resultChannel, run)
+	}
+	run.Completed = time.Now()
+
+	// close the results channel and wait for the results goroutine to finish
+	close(resultChannel)
+	path := <-handleResultsFinished
+
+	// close any cached sessions
+	action.CloseAllSessions()
+
+	log.Printf("\nTestsuite completed in %v\n", time.Since(start))
+	return path
+}
+
+// runClients runs a closed model load, each client iterates over the blocks waiting for each reply before sending its
+// next request. The iterations completed and why the run stopped are recorded in the run information
+func runClients(start, deadline time.Time, ts *suite.TestSuite, resultChannel chan result.NetconfResult, run *result.RunInfo) {
 	// create concurrent sessions for each of the defined clients
 	clientWg := sync.WaitGroup{}
+	iterations := make([]int, ts.Clients)
 	for cID := 0; cID < ts.Clients; cID++ {
 		clientWg.Add(1)
-		go handleBlocks(start, ts, cID, &clientWg, resultChannel)
+		go func(cID int) {
+			defer clientWg.Done()
+			iterations[cID] = handleBlocks(start, deadline, ts, cID, resultChannel)
+		}(cID)
 		// handle rampup for each client
 		var waitDuration = float32(ts.Rampup) / float32(ts.Clients)
 		time.Sleep(time.Duration(int(1000*waitDuration)) * time.Millisecond)
 	}
 	clientWg.Wait()
 
-	// close the results channel and wait for the results goroutine to finish
-	close(resultChannel)
-	<-handleResultsFinished
-
-	// close any cached sessions
-	action.CloseAllSessions()
+	// without a deadline the run can only stop once the iterations are complete, including when there are none
+	run.StopReason = result.StopReasonIterations
+	for _, completed := range iterations {
+		run.Iterations += completed
+		if !deadline.IsZero() && (completed < ts.Iterations || ts.Iterations == 0) {
+			run.StopReason = result.StopReasonDuration
+		}
+	}
+}
 
-	log.Printf("\nTestsuite completed in %v\n", time.Since(start))
+// handleBlocks iterates over the blocks until the suites iterations or the deadline (if not zero) is reached. An
+// iteration is not started once the deadline has passed, including one waiting for its pacing, but one in flight is
+// completed. Returns the number of iterations completed
+func handleBlocks(start, deadline time.Time, ts *suite.TestSuite, cID int, resultChannel chan result.NetconfResult) int {
+	var stop chan bool
+	if !deadline.IsZero() {
+		stop = make(chan bool)
+		timer := time.AfterFunc(time.Until(deadline), func() { close(stop) })
+		defer timer.Stop()
+	}
+	clientStart := time.Now()
+	i := 0
+	for ; i < ts.Iterations || (ts.Iterations == 0 && !deadline.IsZero()); i++ {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			break
+		}
+		if !pacedIteration(start, clientStart, i, ts, cID, stop, resultChannel) {
+			break
+		}
+	}
+	return i
 }
 
-// handleBlocks determines the block type and processes the actions appropriately
-func handleBlocks(start time.Time, ts *suite.TestSuite, cID int, clientWg *sync.WaitGroup, resultChannel chan result.NetconfResult) {
-	for i := 0; i < ts.Iterations; i++ {
-		for _, block := range ts.Blocks {
-			// block sections are executed sequentially, individual blocks may execute actions sequentially or councurrently
-			switch block.Type {
-			case "sequential":
-				for _, a := range block.Actions {
+// executeBlocks runs a single iteration, determining the block type and processing the actions appropriately
+func executeBlocks(start time.Time, ts *suite.TestSuite, cID int, resultChannel chan result.NetconfResult) {
+	for _, block := range ts.Blocks {
+		// block sections are executed sequentially, individual blocks may execute actions sequentially or councurrently
+		switch block.Type {
+		case "sequential":
+			for _, a := range block.Actions {
+				action.Execute(start, cID, ts, a, resultChannel)
+			}
+		case "concurrent":
+			blockWg := sync.WaitGroup{}
+			for _, a := range block.Actions {
+				// do concurrently
+				blockWg.Add(1)
+				go func(a suite.Action) {
+					defer blockWg.Done()
 					action.Execute(start, cID, ts, a, resultChannel)
-				}
-			case "concurrent":
-				blockWg := sync.WaitGroup{}
-				for _, a := range block.Actions {
-					// do concurrently
-					blockWg.Add(1)
-					go func(a suite.Action) {
-						defer blockWg.Done()
-						action.Execute(start, cID, ts, a, resultChannel)
-					}(a)
-				}
-				blockWg.Wait()
-			case "init":
-				// do nothing
+				}(a)
 			}
+			blockWg.Wait()
+		case "init":
+			// do nothing
 		}
 	}
-	clientWg.Done()
 }
 
 func init() {
 	RootCmd.AddCommand(runCmd)
+	runCmd.Flags().Duration("duration", 0, "run for a duration, for e.g. 30m, overriding the suites duration; the run stops when either the iterations or the duration is reached")
 }
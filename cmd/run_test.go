@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"strconv"
@@ -12,8 +13,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/simulator"
 	"github.com/damianoneill/nc-hammer/suite"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
 )
 
 func Test_runCmdArgs(t *testing.T) {
@@ -113,3 +117,97 @@ func Test_runTestSuite(t *testing.T) {
 	os.RemoveAll("results")
 
 }
+
+func Test_handleBlocks(t *testing.T) {
+	ts := &suite.TestSuite{Blocks: []suite.Block{{Type: "sequential", Actions: []suite.Action{{Sleep: &suite.Sleep{Duration: 20}}}}}}
+	resultChannel := make(chan result.NetconfResult)
+	start := time.Now()
+
+	t.Run("iterations reached before the deadline", func(t *testing.T) {
+		ts.Iterations = 3
+		assert.Equal(t, 3, handleBlocks(start, time.Now().Add(time.Minute), ts, 0, resultChannel))
+	})
+	t.Run("deadline reached before the iterations", func(t *testing.T) {
+		ts.Iterations = 1000
+		completed := handleBlocks(start, time.Now().Add(100*time.Millisecond), ts, 0, resultChannel)
+		assert.True(t, completed > 0 && completed < 1000)
+	})
+	t.Run("unlimited iterations stop at the deadline", func(t *testing.T) {
+		ts.Iterations = 0
+		begin := time.Now()
+		completed := handleBlocks(start, begin.Add(100*time.Millisecond), ts, 0, resultChannel)
+		assert.True(t, completed > 0)
+		assert.True(t, time.Since(begin) >= 100*time.Millisecond)
+	})
+	t.Run("deadline already passed", func(t *testing.T) {
+		ts.Iterations = 3
+		assert.Equal(t, 0, handleBlocks(start, time.Now().Add(-time.Second), ts, 0, resultChannel))
+	})
+	t.Run("no deadline and no iterations", func(t *testing.T) {
+		ts.Iterations = 0
+		assert.Equal(t, 0, handleBlocks(start, time.Time{}, ts, 0, resultChannel))
+
+		ts.Clients = 1
+		defer func() { ts.Clients = 0 }()
+		run := &result.RunInfo{}
+		runClients(start, time.Time{}, ts, resultChannel, run)
+		assert.Equal(t, 0, run.Iterations)
+		assert.Equal(t, result.StopReasonIterations, run.StopReason)
+	})
+	t.Run("unlimited iterations stopped by the deadline", func(t *testing.T) {
+		ts.Iterations, ts.Clients = 0, 1
+		defer func() { ts.Clients = 0 }()
+		run := &result.RunInfo{}
+		runClients(start, time.Now().Add(50*time.Millisecond), ts, resultChannel, run)
+		assert.True(t, run.Iterations > 0)
+		assert.Equal(t, result.StopReasonDuration, run.StopReason)
+	})
+}
+
+func Test_runTestSuiteSimulator(t *testing.T) {
+	hostKey, err := simulator.NewHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := simulator.New("admin", "admin", hostKey)
+	if err = sim.LoadDatastore("../simulator/testdata/datastore.xml"); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// nolint
+	go sim.Serve(listener)
+
+	getConfig, editConfig, commit, candidate := "get-config", "edit-config", "commit", "candidate"
+	config := `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth1</name><enabled>true</enabled></interface></interfaces>`
+	expected := "<enabled>true</enabled>"
+	ts := &suite.TestSuite{File: "simulator/test-suite.yml", Iterations: 3, Clients: 2,
+		Configs: suite.Configs{{Hostname: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, Username: "admin", Password: "admin",
+			Reuseconnection: true, Fingerprint: ssh.FingerprintSHA256(hostKey.PublicKey())}},
+		Blocks: []suite.Block{{Type: "sequential", Actions: []suite.Action{
+			{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: &editConfig, Target: &candidate, Config: &config}},
+			{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: &commit}},
+			{Netconf: &suite.Netconf{Hostname: "127.0.0.1", Operation: &getConfig, Expected: &expected}},
+		}}},
+	}
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	rescueStdout := os.Stdout
+	_, w, _ := os.Pipe()
+	os.Stdout = w
+	path := runTestSuite(ts)
+	w.Close()
+	os.Stdout = rescueStdout
+	defer os.RemoveAll("results")
+
+	results, _, err := result.UnarchiveResults(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 18, len(results))
+	for _, r := range results {
+		assert.Equal(t, "", r.Err)
+		assert.True(t, r.SessionID > 0 && r.Latency > 0)
+	}
+}
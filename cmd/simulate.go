@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"errors"
+	"log"
+	"net"
+
+	"github.com/damianoneill/nc-hammer/simulator"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// simulateCmd represents the simulate command
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Serve a local NETCONF SSH simulator that Test Suites can be developed and run against without a device",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 0 {
+			return errors.New("simulate command does not take any arguments")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		//nolint
+		listen, _ := cmd.Flags().GetString("listen")
+		sim, hostKey, err := newSimulator(cmd)
+		if err != nil {
+			log.Fatalf("Problem with simulator: %v ", err)
+		}
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			log.Fatalf("Problem with listening on %v: %v ", listen, err)
+		}
+		log.Printf("NETCONF simulator listening on %v\n", listener.Addr())
+		log.Printf(" > Host key fingerprint %v, use it as the fingerprint of the suites configs\n", ssh.FingerprintSHA256(hostKey.PublicKey()))
+		log.Fatalf("Problem with simulator: %v ", sim.Serve(listener))
+	},
+}
+
+// newSimulator returns a simulator configured by the command flags and the host key it identifies itself with
+func newSimulator(cmd *cobra.Command) (*simulator.Simulator, ssh.Signer, error) {
+	//nolint
+	username, _ := cmd.Flags().GetString("username")
+	//nolint
+	password, _ := cmd.Flags().GetString("password")
+	//nolint
+	hostKeyFile, _ := cmd.Flags().GetString("hostkey")
+	//nolint
+	datastores, _ := cmd.Flags().GetStringSlice("datastore")
+	//nolint
+	rulesFile, _ := cmd.Flags().GetString("rules")
+
+	var hostKey ssh.Signer
+	var err error
+	if hostKeyFile != "" {
+		hostKey, err = simulator.LoadHostKey(hostKeyFile)
+	} else {
+		hostKey, err = simulator.NewHostKey()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sim := simulator.New(username, password, hostKey)
+	for _, datastore := range datastores {
+		if err = sim.LoadDatastore(datastore); err != nil {
+			return nil, nil, err
+		}
+	}
+	if rulesFile != "" {
+		rules, err := simulator.LoadRules(rulesFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = sim.AddRules(rules.Rules...); err != nil {
+			return nil, nil, err
+		}
+		sim.SetMaxSessions(rules.MaxSessions)
+	}
+	return sim, hostKey, nil
+}
+
+func init() {
+	RootCmd.AddCommand(simulateCmd)
+	simulateCmd.Flags().String("listen", "127.0.0.1:8300", "the address the simulator listens on")
+	simulateCmd.Flags().String("username", "admin", "the username clients authenticate with")
+	simulateCmd.Flags().String("password", "admin", "the password clients authenticate with")
+	simulateCmd.Flags().String("hostkey", "", "a PEM encoded private key file the simulator identifies itself with, one is generated if not defined")
+	simulateCmd.Flags().StringSlice("datastore", nil, "xml files the running and candidate datastores are loaded from, can be repeated")
+	simulateCmd.Flags().String("rules", "", "a YAML file of rules injecting canned replies, rpc-errors, latency and faults, and limiting the sessions")
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/action"
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+)
+
+// stageTick is how often the clients are adjusted and the longest an open model waits between checking the rate
+// while a stage is ramping
+const stageTick = 100 * time.Millisecond
+
+// runStages runs the suites load profile, each stage in turn, tagging the results with the stage they completed in
+func runStages(start time.Time, ts *suite.TestSuite, resultChannel chan result.NetconfResult, run *result.RunInfo) {
+	var total time.Duration
+	for _, stage := range ts.Stages {
+		total += time.Duration(stage.Duration) * time.Second
+	}
+	log.Printf(" > %d stage(s) defined, running for %v\n", len(ts.Stages), total)
+
+	var stage int32
+	tagged, tagFinished := tagStage(&stage, resultChannel)
+	if ts.IsRateStages() {
+		runRateStages(start, ts, &stage, tagged, run)
+	} else {
+		runClientStages(start, ts, &stage, tagged, run)
+	}
+	close(tagged)
+	<-tagFinished
+	run.StopReason = result.StopReasonStages
+}
+
+// tagStage returns a channel that forwards results to the result channel, tagged with the current stage
+func tagStage(stage *int32, resultChannel chan result.NetconfResult) (chan result.NetconfResult, chan bool) {
+	tagged := make(chan result.NetconfResult)
+	tagFinished := make(chan bool)
+	go func() {
+		for r := range tagged {
+			r.Stage = int(atomic.LoadInt32(stage))
+			resultChannel <- r
+		}
+		tagFinished <- true
+	}()
+	return tagged, tagFinished
+}
+
+// stageTarget returns the clients or rate targeted at a point in a stage, when ramping this changes linearly from the
+// previous stages target
+func stageTarget(previous, target float64, ramp bool, elapsed, duration time.Duration) float64 {
+	if !ramp || elapsed >= duration {
+		return target
+	}
+	return previous + (target-previous)*float64(elapsed)/float64(duration)
+}
+
+// runClientStages runs a closed model load profile, clients are started and stopped to meet each stages target. A
+// stopped client completes its iteration in flight, or stops waiting for its pacing, and closes its sessions
+func runClientStages(start time.Time, ts *suite.TestSuite, stage *int32, resultChannel chan result.NetconfResult, run *result.RunInfo) {
+	var clients []chan bool // stop channels of the running clients
+	clientWg := sync.WaitGroup{}
+	var iterations int64
+	nextID := 0
+	scale := func(target int) {
+		for len(clients) < target {
+			stop := make(chan bool)
+			clients = append(clients, stop)
+			clientWg.Add(1)
+			go func(cID int) {
+				defer clientWg.Done()
+				defer action.CloseClientSessions(cID, ts.Configs)
+				clientStart := time.Now()
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if !pacedIteration(start, clientStart, i, ts, cID, stop, resultChannel) {
+						return
+					}
+					atomic.AddInt64(&iterations, 1)
+				}
+			}(nextID)
+			// client ids are not reused, a stopped client may still be completing its iteration
+			nextID++
+		}
+		for len(clients) > target {
+			close(clients[len(clients)-1])
+			clients = clients[:len(clients)-1]
+		}
+	}
+
+	previous := 0.0
+	for idx, s := range ts.Stages {
+		atomic.StoreInt32(stage, int32(idx+1))
+		stageStart := time.Now()
+		duration := time.Duration(s.Duration) * time.Second
+		for elapsed := time.Duration(0); elapsed < duration; elapsed = time.Since(stageStart) {
+			scale(int(math.Round(stageTarget(previous, float64(s.Clients), s.Ramp, elapsed, duration))))
+			if remaining := duration - elapsed; remaining < stageTick {
+				time.Sleep(remaining)
+			} else {
+				time.Sleep(stageTick)
+			}
+		}
+		previous = float64(s.Clients)
+	}
+	scale(0)
+	clientWg.Wait()
+	run.Iterations = int(iterations)
+}
+
+// runRateStages runs an open model load profile, arrivals are scheduled at each stages target rate. The rate is
+// accumulated as credit so that low and ramping rates are scheduled accurately, checking the rate at least every tick
+func runRateStages(start time.Time, ts *suite.TestSuite, stage *int32, resultChannel chan result.NetconfResult, run *result.RunInfo) {
+	rate := ts.Rate
+	if rate == nil {
+		rate = &suite.Rate{}
+	}
+	log.Printf(" > Open model, %v(s) per second, up to %d workers\n", rate.GetUnit(), rate.GetMaxWorkers())
+	arrivals := newArrivals(start, ts, rate.GetUnit())
+	if len(arrivals) == 0 {
+		return
+	}
+
+	d := newDispatcher(arrivals, rate.GetMaxWorkers(), resultChannel)
+	previous, credit, expected := 0.0, 0.0, 0.0
+	next, stageStart := d.started, d.started
+	for idx, s := range ts.Stages {
+		atomic.StoreInt32(stage, int32(idx+1))
+		duration := time.Duration(s.Duration) * time.Second
+		end := stageStart.Add(duration)
+		for next.Before(end) {
+			time.Sleep(time.Until(next))
+			target := stageTarget(previous, s.Rate, s.Ramp, next.Sub(stageStart), duration)
+			step := stageTick
+			if target > 0 && time.Duration(float64(time.Second)/target) < step {
+				step = time.Duration(float64(time.Second) / target)
+			}
+			// allow for floating point error so an arrival is not missed at a constant rate
+			credit += target * step.Seconds()
+			for ; credit >= 1-1e-9; credit-- {
+				d.dispatch(next)
+			}
+			next = next.Add(step)
+		}
+		if s.Ramp {
+			expected += (previous + s.Rate) / 2 * duration.Seconds()
+		} else {
+			expected += s.Rate * duration.Seconds()
+		}
+		previous = s.Rate
+		stageStart = end
+	}
+	d.finish(run, rate.GetUnit())
+	if elapsed := stageStart.Sub(d.started).Seconds(); elapsed > 0 {
+		run.TargetRate = expected / elapsed
+	}
+}
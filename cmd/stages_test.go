@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/damianoneill/nc-hammer/suite"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_stageTarget(t *testing.T) {
+	assert.Equal(t, 10.0, stageTarget(0, 10, false, 0, time.Minute))
+	assert.Equal(t, 0.0, stageTarget(0, 10, true, 0, time.Minute))
+	assert.Equal(t, 5.0, stageTarget(0, 10, true, 30*time.Second, time.Minute))
+	assert.Equal(t, 15.0, stageTarget(20, 10, true, 30*time.Second, time.Minute))
+	assert.Equal(t, 10.0, stageTarget(20, 10, true, time.Minute, time.Minute))
+}
+
+func Test_tagStage(t *testing.T) {
+	resultChannel := make(chan result.NetconfResult, 2)
+	var stage int32 = 2
+	tagged, tagFinished := tagStage(&stage, resultChannel)
+	tagged <- result.NetconfResult{Operation: "get"}
+	close(tagged)
+	<-tagFinished
+	assert.Equal(t, 2, (<-resultChannel).Stage)
+}
+
+func Test_runStages(t *testing.T) {
+	sleep := suite.Block{Type: "sequential", Actions: []suite.Action{{Sleep: &suite.Sleep{Duration: 10}}}}
+	resultChannel := make(chan result.NetconfResult)
+
+	t.Run("client stages", func(t *testing.T) {
+		ts := &suite.TestSuite{Blocks: []suite.Block{sleep}, Stages: []suite.Stage{{Clients: 2, Duration: 1}, {Clients: 0, Duration: 1}}}
+		run := &result.RunInfo{}
+		begin := time.Now()
+		runStages(time.Now(), ts, resultChannel, run)
+		assert.True(t, time.Since(begin) >= 2*time.Second)
+		// two clients iterating every 10ms for the first second only
+		assert.True(t, run.Iterations > 100 && run.Iterations <= 202, "iterations %d", run.Iterations)
+		assert.Equal(t, result.StopReasonStages, run.StopReason)
+	})
+	t.Run("rate stages", func(t *testing.T) {
+		ts := &suite.TestSuite{Blocks: []suite.Block{sleep}, Stages: []suite.Stage{{Rate: 20, Duration: 1, Ramp: true}, {Rate: 20, Duration: 1}}}
+		run := &result.RunInfo{}
+		runStages(time.Now(), ts, resultChannel, run)
+		// ramping from 0 to 20 then 20 per second, 10 + 20 arrivals
+		assert.True(t, run.Arrivals >= 28 && run.Arrivals <= 31, "arrivals %d", run.Arrivals)
+		assert.InDelta(t, 15.0, run.TargetRate, 0.01)
+		assert.Equal(t, suite.RateUnitIteration, run.RateUnit)
+	})
+}
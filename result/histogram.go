@@ -0,0 +1,113 @@
+package result
+
+import (
+	"math"
+	"math/bits"
+)
+
+// histogram buckets, values below subBucketCount microseconds are recorded exactly, larger values are recorded in
+// buckets whose width doubles with each power of two giving a relative error of at most 1 in subBucketHalf
+const (
+	subBucketCount = 2048
+	subBucketHalf  = subBucketCount / 2
+)
+
+// Histogram records latencies in milliseconds at microsecond resolution with three significant digits of precision.
+// Its size depends on the range of the values rather than their number, so percentiles of large runs are accurate
+// without keeping every value
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    float64
+	min    float64
+	max    float64
+}
+
+// NewHistogram returns an empty histogram
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+// Record adds a latency in milliseconds to the histogram, negative values are recorded as zero
+func (h *Histogram) Record(latency float64) {
+	if latency < 0 {
+		latency = 0
+	}
+	idx := bucketIndex(int64(math.Round(latency * 1000)))
+	if idx >= len(h.counts) {
+		counts := make([]int64, idx+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[idx]++
+	if h.total == 0 || latency < h.min {
+		h.min = latency
+	}
+	if latency > h.max {
+		h.max = latency
+	}
+	h.total++
+	h.sum += latency
+}
+
+// Count returns the number of latencies recorded
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+// Min returns the lowest latency recorded, zero if none have been
+func (h *Histogram) Min() float64 {
+	return h.min
+}
+
+// Max returns the highest latency recorded, zero if none have been
+func (h *Histogram) Max() float64 {
+	return h.max
+}
+
+// Mean returns the mean latency recorded, zero if none have been
+func (h *Histogram) Mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
+
+// Percentile returns the latency at or below which the pth percentile (0-100) of the latencies recorded fall, zero if
+// none have been
+func (h *Histogram) Percentile(p float64) float64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for idx, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return math.Min(math.Max(float64(highestEquivalent(idx))/1000, h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// bucketIndex returns the bucket a value in microseconds is counted in
+func bucketIndex(value int64) int {
+	if value < subBucketCount {
+		return int(value)
+	}
+	shift := uint(bits.Len64(uint64(value))) - 11
+	return subBucketCount + int(shift-1)*subBucketHalf + int(value>>shift) - subBucketHalf
+}
+
+// highestEquivalent returns the highest value in microseconds counted in a bucket
+func highestEquivalent(idx int) int64 {
+	if idx < subBucketCount {
+		return int64(idx)
+	}
+	shift := uint((idx-subBucketCount)/subBucketHalf) + 1
+	sub := int64((idx-subBucketCount)%subBucketHalf + subBucketHalf)
+	return (sub+1)<<shift - 1
+}
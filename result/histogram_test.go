@@ -0,0 +1,38 @@
+package result_test
+
+import (
+	"testing"
+
+	"github.com/damianoneill/nc-hammer/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := result.NewHistogram()
+	assert.Equal(t, 0.0, h.Percentile(99))
+
+	for i := 1; i <= 1000; i++ {
+		h.Record(float64(i))
+	}
+	assert.Equal(t, int64(1000), h.Count())
+	assert.Equal(t, 1.0, h.Min())
+	assert.Equal(t, 1000.0, h.Max())
+	assert.Equal(t, 500.5, h.Mean())
+	// three significant digits
+	assert.InDelta(t, 500, h.Percentile(50), 0.5)
+	assert.InDelta(t, 900, h.Percentile(90), 0.9)
+	assert.InDelta(t, 990, h.Percentile(99), 1)
+	assert.InDelta(t, 999, h.Percentile(99.9), 1)
+	assert.Equal(t, 1000.0, h.Percentile(100))
+	assert.Equal(t, 1.0, h.Percentile(0))
+}
+
+func TestHistogramSubMillisecond(t *testing.T) {
+	h := result.NewHistogram()
+	h.Record(0.25)
+	h.Record(0.75)
+	h.Record(-1)
+	assert.Equal(t, 0.0, h.Min())
+	assert.Equal(t, 0.25, h.Percentile(50))
+	assert.Equal(t, 0.75, h.Percentile(100))
+}
@@ -12,20 +12,63 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
-// NetconfResult used to store all data related to a NETCONF requests response
+// NetconfResult used to store all data related to a NETCONF requests response. Times are in milliseconds with
+// nanosecond precision, results archived by earlier versions hold whole milliseconds and are read unchanged
 type NetconfResult struct {
-	Client    int
-	SessionID int
-	MessageID string
-	Hostname  string
-	Operation string
-	When      float64
-	Err       string
-	Latency   float64
+	Client       int
+	SessionID    int
+	MessageID    string
+	Hostname     string
+	Operation    string
+	Datastore    string
+	WithDefaults string
+	Stream       string
+	When         float64
+	Err          string
+	Latency      float64
+	// time taken in establishing the session used for the request, only recorded when a new session was established
+	Connect   float64
+	Handshake float64
+	Hello     float64
+	Stage     int // the stage of the load profile (starting at 1) the request completed in, zero without stages
+	// milliseconds since the start of the run that the request was sent and, when paced or scheduled at a rate, was
+	// intended to be sent; the difference is the time spent queued behind earlier requests
+	Sent     float64
+	Intended float64
+	// the fields of an rpc-error returned by the agent, Err holds the error as reported by go-netconf
+	ErrorType     string
+	ErrorTag      string
+	ErrorSeverity string
+	ErrorAppTag   string
+	ErrorPath     string
+	ErrorMessage  string
 }
 
-// HandleResults processes results as they occur
-func HandleResults(resultChannel chan NetconfResult, handleResultsFinished chan bool, ts *suite.TestSuite) {
+// Reasons a Test Suite run stopped
+const (
+	StopReasonIterations = "iterations"
+	StopReasonDuration   = "duration"
+	StopReasonStages     = "stages"
+)
+
+// RunInfo records how a Test Suite run executed, it is archived alongside the results
+type RunInfo struct {
+	Started    time.Time `json:"started" yaml:"started"`
+	Completed  time.Time `json:"completed" yaml:"completed"`
+	Iterations int       `json:"iterations" yaml:"iterations"` // iterations completed across all clients
+	StopReason string    `json:"stopreason" yaml:"stopreason"`
+	// open model runs, the rate achieved is the arrivals completed over the time from the first arrival to the last
+	// completing
+	TargetRate   float64 `json:"targetrate,omitempty" yaml:"targetrate,omitempty"`
+	AchievedRate float64 `json:"achievedrate,omitempty" yaml:"achievedrate,omitempty"`
+	RateUnit     string  `json:"rateunit,omitempty" yaml:"rateunit,omitempty"`
+	Arrivals     int     `json:"arrivals,omitempty" yaml:"arrivals,omitempty"`
+	Workers      int     `json:"workers,omitempty" yaml:"workers,omitempty"`
+}
+
+// HandleResults processes results as they occur, the run information is archived with the results so should be
+// completed before the result channel is closed. The directory the results were archived to is sent on finishing
+func HandleResults(resultChannel chan NetconfResult, handleResultsFinished chan string, ts *suite.TestSuite, run *RunInfo) {
 	// sit here collecting results until the channel is closed by the main go routine
 	results := []NetconfResult{}
 	for result := range resultChannel {
@@ -36,28 +79,26 @@ func HandleResults(resultChannel chan NetconfResult, handleResultsFinished chan
 	}
 
 	// store results for future processing
-	err := ArchiveResults(results, ts)
+	path, err := ArchiveResults(results, ts, run)
 	if err != nil {
 		panic(err)
 	}
 
-	handleResultsFinished <- true
+	handleResultsFinished <- path
 }
 
-// ArchiveResults stores results for future processing
-func ArchiveResults(results []NetconfResult, ts *suite.TestSuite) error {
-	// create the output directory based on current timestamp
-	now := time.Now().Format("2006-01-02-15-04-05")
-	path := filepath.Join("./results", now)
-	err := os.MkdirAll(path, os.ModePerm)
+// ArchiveResults stores results for future processing, run information is optional. Returns the directory the
+// results were archived to
+func ArchiveResults(results []NetconfResult, ts *suite.TestSuite, run *RunInfo) (string, error) {
+	path, err := newResultsDir(time.Now())
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// open a file for writing
 	resultsFile, err := os.OpenFile(filepath.Join(path, "results.csv"), os.O_RDWR|os.O_CREATE, os.ModePerm)
 	if err != nil {
-		return err
+		return "", err
 	}
 	// nolint
 	defer resultsFile.Close()
@@ -65,16 +106,44 @@ func ArchiveResults(results []NetconfResult, ts *suite.TestSuite) error {
 	// write the results as a csv file
 	err = gocsv.MarshalFile(results, resultsFile)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// write the TestSuite, which included any xml files inlined.
 	bytes, err := yaml.Marshal(&ts)
 	if err != nil {
-		return err
+		return "", err
 	}
 	err = ioutil.WriteFile(filepath.Join(path, "test-suite.yml"), bytes, 0644)
-	return err
+	if err != nil || run == nil {
+		return path, err
+	}
+
+	bytes, err = yaml.Marshal(run)
+	if err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(filepath.Join(path, "run.yml"), bytes, 0644)
+}
+
+// newResultsDir creates the output directory based on a timestamp, runs archived within the same second (for e.g. the
+// steps of a capacity search) are suffixed to keep them apart
+func newResultsDir(now time.Time) (string, error) {
+	if err := os.MkdirAll("./results", os.ModePerm); err != nil {
+		return "", err
+	}
+	base := filepath.Join("./results", now.Format("2006-01-02-15-04-05"))
+	path := base
+	for i := 1; ; i++ {
+		err := os.Mkdir(path, os.ModePerm)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		path = fmt.Sprintf("%v-%d", base, i)
+	}
 }
 
 // UnarchiveResults loads a test suite results from the filesystem
@@ -97,3 +166,20 @@ func UnarchiveResults(resultsPath string) ([]NetconfResult, *suite.TestSuite, er
 
 	return results, s, err
 }
+
+// UnarchiveRunInfo loads the information recorded about a test suite run, results archived before this was recorded
+// return nil
+func UnarchiveRunInfo(resultsPath string) (*RunInfo, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(resultsPath, "run.yml")) // #nosec
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var run RunInfo
+	if err = yaml.Unmarshal(bytes, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
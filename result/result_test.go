@@ -1,10 +1,12 @@
 package result_test
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/damianoneill/nc-hammer/result"
 	"github.com/damianoneill/nc-hammer/suite"
@@ -24,9 +26,9 @@ func TestHandleResults(t *testing.T) {
 
 	var mockTestsuite = &suite.TestSuite{}
 	var mockResultChan = make(chan result.NetconfResult)
-	var mockResultsHandler = make(chan bool)
+	var mockResultsHandler = make(chan string)
 
-	go result.HandleResults(mockResultChan, mockResultsHandler, mockTestsuite) // run channels
+	go result.HandleResults(mockResultChan, mockResultsHandler, mockTestsuite, nil) // run channels
 
 	// feed mock data into result.HandleResults() via mockResultChan channel
 	expectedResults := []result.NetconfResult{}
@@ -63,3 +65,55 @@ func TestUnarchiveResults(t *testing.T) {
 	assert.Equal(t, actualErr, expectedErr)
 
 }
+
+func TestArchiveRunInfo(t *testing.T) {
+	defer os.RemoveAll("results/")
+	started := time.Date(2018, 7, 18, 19, 56, 1, 0, time.UTC)
+	run := &result.RunInfo{Started: started, Completed: started.Add(time.Minute), Iterations: 12, StopReason: result.StopReasonDuration}
+	path, err := result.ArchiveResults([]result.NetconfResult{}, &suite.TestSuite{}, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := result.UnarchiveRunInfo(path)
+	assert.Nil(t, err)
+	assert.Equal(t, run.StopReason, actual.StopReason)
+	assert.Equal(t, run.Iterations, actual.Iterations)
+	assert.True(t, run.Started.Equal(actual.Started) && run.Completed.Equal(actual.Completed))
+
+	// archives created before run information was recorded
+	actual, err = result.UnarchiveRunInfo("../suite/testdata/results_test/2018-07-18-19-56-01/")
+	assert.Nil(t, err)
+	assert.Nil(t, actual)
+}
+
+func TestArchiveResultsUniqueDirectory(t *testing.T) {
+	defer os.RemoveAll("results/")
+	paths := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		path, err := result.ArchiveResults([]result.NetconfResult{}, &suite.TestSuite{}, nil)
+		assert.Nil(t, err)
+		paths[path] = true
+	}
+	assert.Len(t, paths, 3)
+	dirs, _ := ioutil.ReadDir("results")
+	assert.Len(t, dirs, 3)
+}
+
+func TestArchiveResultsPrecision(t *testing.T) {
+	defer os.RemoveAll("results/")
+	results := []result.NetconfResult{{Hostname: "10.0.0.1", Operation: "get", When: 12.345678, Latency: 0.123456}}
+	ts := &suite.TestSuite{Iterations: 1, Clients: 1, Configs: suite.Configs{{Hostname: "10.0.0.1", Port: 830, Username: "uname", Password: "pass"}}}
+	path, err := result.ArchiveResults(results, ts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, _, err := result.UnarchiveResults(path)
+	assert.Nil(t, err)
+	assert.Equal(t, results[0].When, actual[0].When)
+	assert.Equal(t, results[0].Latency, actual[0].Latency)
+
+	// archives created before sub millisecond precision was recorded
+	actual, _, err = result.UnarchiveResults("../suite/testdata/results_test/2018-07-18-19-56-01/")
+	assert.Nil(t, err)
+	assert.Equal(t, 443.0, actual[0].Latency)
+}
@@ -0,0 +1,247 @@
+package simulator
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Datastores served by the simulator
+const (
+	Running   = "running"
+	Candidate = "candidate"
+)
+
+// Edit operations, RFC 6241 section 7.2
+const (
+	operationMerge   = "merge"
+	operationReplace = "replace"
+	operationCreate  = "create"
+	operationDelete  = "delete"
+	operationRemove  = "remove"
+	operationNone    = "none"
+)
+
+// readConfig returns the top level configuration elements of an xml file, the elements are either the root or the
+// children of a <data> or <config> root so a get-config reply or an edit-config can be used as is
+func readConfig(path string) ([]*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(path); err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, errors.New(path + " does not contain any elements")
+	}
+	if root.Tag == "data" || root.Tag == "config" {
+		return root.ChildElements(), nil
+	}
+	return []*etree.Element{root}, nil
+}
+
+// editConfig applies the children of an edit-config config element to a datastore, on an error the datastore may be
+// partially edited so callers edit a copy that replaces the datastore when the edit succeeds
+func editConfig(datastore, config *etree.Element, defaultOperation string) *RPCError {
+	for _, edit := range config.ChildElements() {
+		if err := editElement(datastore, edit, defaultOperation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// editElement applies an edit to the children of parent, the operation of the edit is inherited by its descendants
+// unless they define their own
+func editElement(parent, edit *etree.Element, inherited string) *RPCError {
+	operation := inherited
+	if attr := operationAttr(edit); attr != nil {
+		operation = attr.Value
+	}
+	existing := matchElement(parent, edit)
+	switch operation {
+	case operationCreate:
+		if existing != nil {
+			return &RPCError{Type: errorTypeApplication, Tag: "data-exists", Message: edit.Tag + " already exists"}
+		}
+		parent.AddChild(configCopy(edit))
+	case operationDelete:
+		if existing == nil {
+			return &RPCError{Type: errorTypeApplication, Tag: "data-missing", Message: edit.Tag + " does not exist"}
+		}
+		parent.RemoveChild(existing)
+	case operationRemove:
+		if existing != nil {
+			parent.RemoveChild(existing)
+		}
+	case operationReplace:
+		if existing != nil {
+			parent.InsertChild(existing, configCopy(edit))
+			parent.RemoveChild(existing)
+		} else {
+			parent.AddChild(configCopy(edit))
+		}
+	case operationMerge, operationNone:
+		if existing == nil {
+			// with a none default operation, elements are only created when a descendant defines an operation
+			if operation == operationNone && !hasOperation(edit) {
+				return nil
+			}
+			if operation == operationMerge {
+				parent.AddChild(configCopy(edit))
+				return nil
+			}
+			existing = shallowCopy(edit)
+			parent.AddChild(existing)
+		}
+		children := edit.ChildElements()
+		if len(children) == 0 {
+			if operation == operationMerge {
+				existing.SetText(edit.Text())
+			}
+			return nil
+		}
+		for _, child := range children {
+			if err := editElement(existing, child, operation); err != nil {
+				return err
+			}
+		}
+	default:
+		return &RPCError{Type: errorTypeProtocol, Tag: "bad-attribute", Message: operation + " is not a valid operation"}
+	}
+	return nil
+}
+
+// matchElement returns the child of parent an edit applies to. Without the schema, an element with children is
+// matched on its tag and the value of its first child, as the keys of a list entry are encoded first (RFC 7950
+// section 7.8.5), other elements are matched on their tag
+func matchElement(parent, edit *etree.Element) *etree.Element {
+	var key *etree.Element
+	if children := edit.ChildElements(); len(children) > 0 && len(children[0].ChildElements()) == 0 {
+		key = children[0]
+	}
+	for _, child := range parent.ChildElements() {
+		if child.Tag != edit.Tag {
+			continue
+		}
+		if key == nil {
+			return child
+		}
+		if existing := child.SelectElement(key.Tag); existing != nil && strings.TrimSpace(existing.Text()) == strings.TrimSpace(key.Text()) {
+			return child
+		}
+	}
+	return nil
+}
+
+// operationAttr returns the operation attribute of an element whatever the prefix of the base namespace, nil if the
+// element does not define one
+func operationAttr(e *etree.Element) *etree.Attr {
+	for idx := range e.Attr {
+		if e.Attr[idx].Key == "operation" {
+			return &e.Attr[idx]
+		}
+	}
+	return nil
+}
+
+// hasOperation returns true if an element or any of its descendants defines an operation
+func hasOperation(e *etree.Element) bool {
+	if operationAttr(e) != nil {
+		return true
+	}
+	for _, child := range e.ChildElements() {
+		if hasOperation(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// configCopy returns a copy of an edit to be stored in a datastore, without the operation attributes
+func configCopy(edit *etree.Element) *etree.Element {
+	c := edit.Copy()
+	removeOperations(c)
+	return c
+}
+
+func removeOperations(e *etree.Element) {
+	attrs := e.Attr[:0]
+	for _, attr := range e.Attr {
+		if attr.Key != "operation" {
+			attrs = append(attrs, attr)
+		}
+	}
+	e.Attr = attrs
+	for _, child := range e.ChildElements() {
+		removeOperations(child)
+	}
+}
+
+// shallowCopy returns a copy of an element without its children
+func shallowCopy(e *etree.Element) *etree.Element {
+	c := etree.NewElement(e.Tag)
+	c.Space = e.Space
+	for _, attr := range e.Attr {
+		if attr.Key != "operation" {
+			c.Attr = append(c.Attr, attr)
+		}
+	}
+	return c
+}
+
+// filterSubtree returns copies of the children of data selected by the children of a subtree filter, RFC 6241
+// section 6. Elements are matched on their tag, attribute match expressions are not supported
+func filterSubtree(data, filter *etree.Element) []*etree.Element {
+	var selected []*etree.Element
+	for _, child := range data.ChildElements() {
+		for _, node := range filter.ChildElements() {
+			if node.Tag != child.Tag {
+				continue
+			}
+			if e := filterElement(child, node); e != nil {
+				selected = append(selected, e)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// filterElement returns a copy of an element as selected by a filter node, nil if the element is not selected
+func filterElement(e, node *etree.Element) *etree.Element {
+	children := node.ChildElements()
+	if len(children) == 0 {
+		// a selection node selects the element and its descendants, a content match node those with its value
+		if text := strings.TrimSpace(node.Text()); text != "" && text != strings.TrimSpace(e.Text()) {
+			return nil
+		}
+		return e.Copy()
+	}
+
+	// a containment node, each of its content match nodes must match a child of the element
+	contentOnly := true
+	for _, child := range children {
+		text := strings.TrimSpace(child.Text())
+		if len(child.ChildElements()) > 0 || text == "" {
+			contentOnly = false
+			continue
+		}
+		if match := e.SelectElement(child.Tag); match == nil || strings.TrimSpace(match.Text()) != text {
+			return nil
+		}
+	}
+	// all of the children of an element are selected when the containment node only holds content match nodes
+	if contentOnly {
+		return e.Copy()
+	}
+	selected := filterSubtree(e, node)
+	if len(selected) == 0 {
+		return nil
+	}
+	c := shallowCopy(e)
+	for _, child := range selected {
+		c.AddChild(child)
+	}
+	return c
+}
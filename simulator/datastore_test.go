@@ -0,0 +1,90 @@
+package simulator
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+func element(t *testing.T, s string) *etree.Element {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(s); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Root()
+}
+
+func xmlString(t *testing.T, e *etree.Element) string {
+	doc := etree.NewDocument()
+	doc.SetRoot(e.Copy())
+	s, err := doc.WriteToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func Test_editConfig(t *testing.T) {
+	datastore := `<data><interfaces><interface><name>eth0</name><mtu>1500</mtu></interface><interface><name>eth1</name><mtu>1500</mtu></interface></interfaces></data>`
+	tests := []struct {
+		name             string
+		config           string
+		defaultOperation string
+		want             string
+		err              string
+	}{
+		{"merge a leaf of a list entry", `<config><interfaces><interface><name>eth1</name><mtu>9000</mtu></interface></interfaces></config>`, operationMerge,
+			`<data><interfaces><interface><name>eth0</name><mtu>1500</mtu></interface><interface><name>eth1</name><mtu>9000</mtu></interface></interfaces></data>`, ""},
+		{"merge a new list entry", `<config><interfaces><interface><name>eth2</name></interface></interfaces></config>`, operationMerge,
+			`<data><interfaces><interface><name>eth0</name><mtu>1500</mtu></interface><interface><name>eth1</name><mtu>1500</mtu></interface><interface><name>eth2</name></interface></interfaces></data>`, ""},
+		{"delete a list entry", `<config><interfaces><interface operation="delete"><name>eth0</name></interface></interfaces></config>`, operationMerge,
+			`<data><interfaces><interface><name>eth1</name><mtu>1500</mtu></interface></interfaces></data>`, ""},
+		{"delete a missing list entry", `<config><interfaces><interface operation="delete"><name>eth2</name></interface></interfaces></config>`, operationMerge, "", "data-missing"},
+		{"remove a missing list entry", `<config><interfaces><interface nc:operation="remove"><name>eth2</name></interface></interfaces></config>`, operationMerge, datastore, ""},
+		{"create an existing list entry", `<config><interfaces><interface operation="create"><name>eth0</name></interface></interfaces></config>`, operationMerge, "", "data-exists"},
+		{"replace a list entry", `<config><interfaces><interface operation="replace"><name>eth0</name></interface></interfaces></config>`, operationMerge,
+			`<data><interfaces><interface><name>eth0</name></interface><interface><name>eth1</name><mtu>1500</mtu></interface></interfaces></data>`, ""},
+		{"none only applies explicit operations", `<config><interfaces><interface><name>eth0</name><mtu operation="merge">9000</mtu></interface><interface><name>eth2</name></interface></interfaces></config>`, operationNone,
+			`<data><interfaces><interface><name>eth0</name><mtu>9000</mtu></interface><interface><name>eth1</name><mtu>1500</mtu></interface></interfaces></data>`, ""},
+		{"invalid operation", `<config><interfaces operation="move"/></config>`, operationMerge, "", "bad-attribute"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := element(t, datastore)
+			err := editConfig(data, element(t, tt.config), tt.defaultOperation)
+			if tt.err != "" {
+				assert.NotNil(t, err)
+				assert.Equal(t, tt.err, err.Tag)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, xmlString(t, data))
+		})
+	}
+}
+
+func Test_filterSubtree(t *testing.T) {
+	datastore := `<data><interfaces><interface><name>eth0</name><mtu>1500</mtu></interface><interface><name>eth1</name><mtu>9000</mtu></interface></interfaces><system><hostname>sim</hostname></system></data>`
+	tests := []struct {
+		name   string
+		filter string
+		want   string
+	}{
+		{"selection node", `<filter><system/></filter>`, `<data><system><hostname>sim</hostname></system></data>`},
+		{"content match node", `<filter><interfaces><interface><name>eth1</name></interface></interfaces></filter>`,
+			`<data><interfaces><interface><name>eth1</name><mtu>9000</mtu></interface></interfaces></data>`},
+		{"content match and selection nodes", `<filter><interfaces><interface><name>eth0</name><mtu/></interface></interfaces></filter>`,
+			`<data><interfaces><interface><name>eth0</name><mtu>1500</mtu></interface></interfaces></data>`},
+		{"nothing selected", `<filter><interfaces><interface><name>eth2</name></interface></interfaces></filter>`, `<data/>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := etree.NewElement("data")
+			for _, e := range filterSubtree(element(t, datastore), element(t, tt.filter)) {
+				data.AddChild(e)
+			}
+			assert.Equal(t, tt.want, xmlString(t, data))
+		})
+	}
+}
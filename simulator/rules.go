@@ -0,0 +1,129 @@
+package simulator
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Rule changes how the simulator answers the RPCs it applies to, with a canned reply or an rpc-error in place of the
+// simulators own reply and with faults injected into how the reply is sent. A rule applies to an RPC when its
+// operation, the name of the first element of the RPC, and its match, a regular expression applied to the RPC as
+// received, both match. Either may be omitted, a rule without either applies to all RPCs
+type Rule struct {
+	Operation string `yaml:"operation,omitempty"`
+	Match     string `yaml:"match,omitempty"`
+	// the contents of the rpc-reply, either inline or in an xml file, or an rpc-error. The simulators own reply is
+	// sent if none of these are defined
+	Reply     string    `yaml:"reply,omitempty"`
+	ReplyFile string    `yaml:"replyfile,omitempty"`
+	Error     *RPCError `yaml:"error,omitempty"`
+	// the reply is delayed by the latency in milliseconds, plus a random delay of up to jitter milliseconds
+	Latency int `yaml:"latency,omitempty"`
+	Jitter  int `yaml:"jitter,omitempty"`
+	// drop closes the channel part way through sending the reply, malformed sends the reply with framing that cannot
+	// be parsed and then closes the channel
+	Drop      bool `yaml:"drop,omitempty"`
+	Malformed bool `yaml:"malformed,omitempty"`
+
+	match *regexp.Regexp
+	reply []*etree.Element
+}
+
+// Rules is the YAML file rules are loaded from, along with the limit on the number of concurrent sessions, sessions
+// beyond the limit are refused. There is no limit if zero
+type Rules struct {
+	MaxSessions int    `yaml:"maxsessions,omitempty"`
+	Rules       []Rule `yaml:"rules"`
+}
+
+// LoadRules reads rules from a YAML file, reply files are relative to the directory of the rules file
+func LoadRules(path string) (*Rules, error) {
+	bytes, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	var rules Rules
+	if err = yaml.UnmarshalStrict(bytes, &rules); err != nil {
+		return nil, err
+	}
+	if rules.MaxSessions < 0 {
+		return nil, errors.New("maxsessions cannot be negative")
+	}
+	for idx := range rules.Rules {
+		if rules.Rules[idx].ReplyFile != "" && !filepath.IsAbs(rules.Rules[idx].ReplyFile) {
+			rules.Rules[idx].ReplyFile = filepath.Join(filepath.Dir(path), rules.Rules[idx].ReplyFile)
+		}
+	}
+	return &rules, nil
+}
+
+// compile validates a rule, parsing its match and reply
+func (r *Rule) compile() error {
+	switch {
+	case r.Latency < 0 || r.Jitter < 0:
+		return errors.New("rule latency and jitter cannot be negative")
+	case r.Drop && r.Malformed:
+		return errors.New("rule cannot both drop and malform a reply")
+	case r.Error != nil && (r.Reply != "" || r.ReplyFile != ""):
+		return errors.New("rule cannot have both a reply and an error")
+	case r.Error != nil && r.Error.Tag == "":
+		return errors.New("rule error must have a tag")
+	}
+	var err error
+	if r.match, err = regexp.Compile(r.Match); err != nil {
+		return err
+	}
+	reply := r.Reply
+	if r.ReplyFile != "" {
+		bytes, err := ioutil.ReadFile(r.ReplyFile) // #nosec
+		if err != nil {
+			return err
+		}
+		reply = string(bytes)
+	}
+	// an xml declaration is only allowed at the start of a document
+	if reply = strings.TrimSpace(reply); strings.HasPrefix(reply, "<?xml") {
+		reply = reply[strings.Index(reply, "?>")+2:]
+	}
+	if reply == "" {
+		return nil
+	}
+	// the reply may hold several elements so is parsed within a wrapper
+	doc := etree.NewDocument()
+	if err = doc.ReadFromString("<reply>" + reply + "</reply>"); err != nil {
+		return errors.New("rule reply is not valid xml: " + err.Error())
+	}
+	r.reply = doc.Root().ChildElements()
+	return nil
+}
+
+// applies returns true if the rule applies to an RPC
+func (r *Rule) applies(operation string, rpc []byte) bool {
+	return (r.Operation == "" || r.Operation == operation) && r.match.Match(rpc)
+}
+
+// replyElements returns a copy of the contents of the reply, nil if the rule does not have a reply
+func (r *Rule) replyElements() []*etree.Element {
+	var elements []*etree.Element
+	for _, e := range r.reply {
+		elements = append(elements, e.Copy())
+	}
+	return elements
+}
+
+// delay returns how long the reply is delayed by
+func (r *Rule) delay() time.Duration {
+	latency := time.Duration(r.Latency) * time.Millisecond
+	if r.Jitter > 0 {
+		latency += time.Duration(rand.Int63n(int64(r.Jitter) * int64(time.Millisecond))) // #nosec
+	}
+	return latency
+}
@@ -0,0 +1,526 @@
+package simulator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Juniper/go-netconf/netconf"
+	"github.com/beevik/etree"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshNetconfSubsystem is the ssh subsystem NETCONF is served over (RFC 6242)
+const sshNetconfSubsystem = "netconf"
+
+// Capabilities advertised in the simulators hello
+const (
+	baseNamespace       = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	base10Capability    = "urn:ietf:params:netconf:base:1.0"
+	base11Capability    = "urn:ietf:params:netconf:base:1.1"
+	candidateCapability = "urn:ietf:params:netconf:capability:candidate:1.0"
+)
+
+// Error types, RFC 6241 appendix A
+const (
+	errorTypeRPC         = "rpc"
+	errorTypeProtocol    = "protocol"
+	errorTypeApplication = "application"
+)
+
+// Simulator is a NETCONF agent served over SSH for developing and testing Test Suites without a device. Its sessions
+// share running and candidate datastores, RPCs are answered by the first rule that applies or by the operations
+// implemented by the simulator
+type Simulator struct {
+	config     *ssh.ServerConfig
+	rules      []Rule
+	mutex      sync.Mutex
+	datastores map[string]*etree.Element
+	locks      map[string]int
+	sessions   map[int]io.Closer
+	lastID     int
+	// sessions beyond the limit are refused, there is no limit if zero
+	maxSessions int
+}
+
+// New returns a simulator with empty datastores, clients authenticate with a username and password and the simulator
+// identifies itself with the host key
+func New(username, password string, hostKey ssh.Signer) *Simulator {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == username && subtle.ConstantTimeCompare(pass, []byte(password)) == 1 {
+				return nil, nil
+			}
+			return nil, errors.New("password rejected for " + c.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+	return &Simulator{
+		config:     config,
+		datastores: map[string]*etree.Element{Running: etree.NewElement("data"), Candidate: etree.NewElement("data")},
+		locks:      make(map[string]int),
+		sessions:   make(map[int]io.Closer),
+	}
+}
+
+// NewHostKey generates a host key for a simulator
+func NewHostKey() (ssh.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+// LoadHostKey reads a host key for a simulator from a PEM encoded private key file
+func LoadHostKey(path string) (ssh.Signer, error) {
+	bytes, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(bytes)
+}
+
+// LoadDatastore adds the configuration in an xml file to the running and candidate datastores, the file holds either
+// a single top level element or a <data> or <config> element containing them
+func (s *Simulator) LoadDatastore(path string) error {
+	elements, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, datastore := range s.datastores {
+		for _, e := range elements {
+			datastore.AddChild(configCopy(e))
+		}
+	}
+	return nil
+}
+
+// AddRules adds canned reply rules, they are checked in the order added before the operations implemented by the
+// simulator
+func (s *Simulator) AddRules(rules ...Rule) error {
+	for idx := range rules {
+		if err := rules[idx].compile(); err != nil {
+			return err
+		}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rules = append(s.rules, rules...)
+	return nil
+}
+
+// SetMaxSessions limits the number of concurrent sessions, sessions beyond the limit are refused. There is no limit if
+// zero
+func (s *Simulator) SetMaxSessions(maxSessions int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.maxSessions = maxSessions
+}
+
+// Serve accepts connections on the listener until it is closed, each connection is served in its own goroutine
+func (s *Simulator) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn performs the ssh handshake and serves the netconf subsystem on each session channel opened
+func (s *Simulator) serveConn(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		log.Printf("Problem with SSH connection from %v: %v ", conn.RemoteAddr(), err)
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			// nolint
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		id, channel, requests, err := s.acceptSession(newChannel)
+		if err == errSessionLimit {
+			log.Printf("Session from %v refused, the session limit has been reached\n", conn.RemoteAddr())
+			continue
+		}
+		if err != nil {
+			return
+		}
+		go func() {
+			started := false
+			for req := range requests {
+				ok := !started && req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == sshNetconfSubsystem
+				// nolint
+				req.Reply(ok, nil)
+				if ok {
+					started = true
+					go s.serveSession(id, channel)
+				}
+			}
+			// the channel closed before the netconf subsystem was requested
+			if !started {
+				s.endSession(id)
+			}
+		}()
+	}
+}
+
+// errSessionLimit is returned when a session is refused as the limit on concurrent sessions has been reached
+var errSessionLimit = errors.New("session limit reached")
+
+// acceptSession accepts a session channel unless the session limit has been reached, returning the session id
+func (s *Simulator) acceptSession(newChannel ssh.NewChannel) (int, ssh.Channel, <-chan *ssh.Request, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.maxSessions > 0 && len(s.sessions) >= s.maxSessions {
+		// nolint
+		newChannel.Reject(ssh.ResourceShortage, "the limit of "+strconv.Itoa(s.maxSessions)+" sessions has been reached")
+		return 0, nil, nil, errSessionLimit
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	s.lastID++
+	s.sessions[s.lastID] = channel
+	return s.lastID, channel, requests, nil
+}
+
+// serveSession exchanges hellos and answers RPCs until the client closes the session or the channel
+func (s *Simulator) serveSession(id int, channel ssh.Channel) {
+	defer s.endSession(id)
+	// nolint
+	defer channel.Close()
+
+	t := newTransport(channel)
+	hello, err := xml.Marshal(&netconf.HelloMessage{Capabilities: []string{base10Capability, base11Capability, candidateCapability}, SessionID: id})
+	if err != nil {
+		return
+	}
+	if err = t.Send(append([]byte(xml.Header), hello...)); err != nil {
+		return
+	}
+	message, err := t.Receive()
+	if err != nil {
+		return
+	}
+	clientHello := new(netconf.HelloMessage)
+	if err = xml.Unmarshal(message, clientHello); err != nil {
+		return
+	}
+	for _, capability := range clientHello.Capabilities {
+		if capability == base11Capability {
+			t.chunked = true
+		}
+	}
+
+	for {
+		rpc, err := t.Receive()
+		if err != nil {
+			return
+		}
+		r := s.handle(id, rpc)
+		time.Sleep(r.delay)
+		switch {
+		case r.drop:
+			// nolint
+			t.SendPartial(r.reply)
+			return
+		case r.malformed:
+			// nolint
+			t.SendMalformed(r.reply)
+			return
+		}
+		if err = t.Send(r.reply); err != nil || r.closeSession {
+			return
+		}
+	}
+}
+
+// endSession releases the locks held by a session
+func (s *Simulator) endSession(id int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.sessions, id)
+	for datastore, holder := range s.locks {
+		if holder == id {
+			delete(s.locks, datastore)
+		}
+	}
+}
+
+// response is the reply to an RPC and how it is to be sent
+type response struct {
+	reply        []byte
+	delay        time.Duration
+	drop         bool
+	malformed    bool
+	closeSession bool // once the reply has been sent
+}
+
+// handle returns the response to an RPC, from the first rule that applies to it or the operation implemented
+func (s *Simulator) handle(id int, rpc []byte) response {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(rpc); err != nil || doc.Root() == nil || doc.Root().Tag != "rpc" {
+		return response{reply: rpcReply(nil, nil, &RPCError{Type: errorTypeRPC, Tag: "malformed-message", Message: "message is not a well formed rpc"})}
+	}
+	request := doc.Root()
+	if request.SelectAttrValue("message-id", "") == "" {
+		return response{reply: rpcReply(request, nil, &RPCError{Type: errorTypeRPC, Tag: "missing-attribute", Message: "rpc does not have a message-id"})}
+	}
+	operations := request.ChildElements()
+	if len(operations) == 0 {
+		return response{reply: rpcReply(request, nil, &RPCError{Type: errorTypeRPC, Tag: "missing-element", Message: "rpc does not have an operation"})}
+	}
+	operation := operations[0]
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for idx := range s.rules {
+		rule := &s.rules[idx]
+		if !rule.applies(operation.Tag, rpc) {
+			continue
+		}
+		r := response{delay: rule.delay(), drop: rule.Drop, malformed: rule.Malformed}
+		switch {
+		case rule.Error != nil:
+			r.reply = rpcReply(request, nil, rule.Error)
+		case rule.reply != nil:
+			r.reply = rpcReply(request, rule.replyElements(), nil)
+		default:
+			data, rerr := s.execute(id, operation)
+			r.reply = rpcReply(request, data, rerr)
+			r.closeSession = operation.Tag == "close-session" && rerr == nil
+		}
+		return r
+	}
+	data, rerr := s.execute(id, operation)
+	return response{reply: rpcReply(request, data, rerr), closeSession: operation.Tag == "close-session" && rerr == nil}
+}
+
+// execute performs an operation, returning the contents of the reply
+func (s *Simulator) execute(id int, operation *etree.Element) ([]*etree.Element, *RPCError) {
+	ok := []*etree.Element{etree.NewElement("ok")}
+	switch operation.Tag {
+	case "get":
+		data, err := s.get(Running, operation)
+		return []*etree.Element{data}, err
+	case "get-config":
+		source, err := datastoreName(operation, "source")
+		if err != nil {
+			return nil, err
+		}
+		data, err := s.get(source, operation)
+		return []*etree.Element{data}, err
+	case "edit-config":
+		return ok, s.editConfig(id, operation)
+	case "lock", "unlock":
+		target, err := datastoreName(operation, "target")
+		if err != nil {
+			return nil, err
+		}
+		if operation.Tag == "lock" {
+			return ok, s.lock(id, target)
+		}
+		return ok, s.unlock(id, target)
+	case "commit":
+		if holder := s.locks[Running]; holder != 0 && holder != id {
+			return nil, lockHeld("in-use", Running, holder)
+		}
+		s.datastores[Running] = s.datastores[Candidate].Copy()
+		return ok, nil
+	case "discard-changes":
+		s.datastores[Candidate] = s.datastores[Running].Copy()
+		return ok, nil
+	case "validate", "close-session":
+		return ok, nil
+	case "kill-session":
+		return ok, s.killSession(id, operation)
+	default:
+		return nil, &RPCError{Type: errorTypeProtocol, Tag: "operation-not-supported", Message: operation.Tag + " is not supported by the simulator"}
+	}
+}
+
+// get returns the contents of a datastore selected by the operations filter
+func (s *Simulator) get(datastore string, operation *etree.Element) (*etree.Element, *RPCError) {
+	filter := operation.SelectElement("filter")
+	if filter == nil {
+		return s.datastores[datastore].Copy(), nil
+	}
+	if filter.SelectAttrValue("type", "subtree") != "subtree" {
+		return nil, &RPCError{Type: errorTypeProtocol, Tag: "operation-not-supported", Message: "only subtree filters are supported by the simulator"}
+	}
+	data := etree.NewElement("data")
+	for _, e := range filterSubtree(s.datastores[datastore], filter) {
+		data.AddChild(e)
+	}
+	return data, nil
+}
+
+func (s *Simulator) editConfig(id int, operation *etree.Element) *RPCError {
+	target, err := datastoreName(operation, "target")
+	if err != nil {
+		return err
+	}
+	if holder := s.locks[target]; holder != 0 && holder != id {
+		return lockHeld("in-use", target, holder)
+	}
+	config := operation.SelectElement("config")
+	if config == nil {
+		return &RPCError{Type: errorTypeProtocol, Tag: "missing-element", Message: "edit-config does not have a config, url is not supported by the simulator"}
+	}
+	defaultOperation := operationMerge
+	if e := operation.SelectElement("default-operation"); e != nil {
+		defaultOperation = strings.TrimSpace(e.Text())
+	}
+	if defaultOperation != operationMerge && defaultOperation != operationReplace && defaultOperation != operationNone {
+		return &RPCError{Type: errorTypeProtocol, Tag: "invalid-value", Message: defaultOperation + " is not a valid default-operation"}
+	}
+
+	edited := s.datastores[target].Copy()
+	if defaultOperation == operationReplace {
+		edited = etree.NewElement("data")
+	}
+	if err = editConfig(edited, config, defaultOperation); err != nil {
+		return err
+	}
+	s.datastores[target] = edited
+	return nil
+}
+
+func (s *Simulator) lock(id int, target string) *RPCError {
+	if holder := s.locks[target]; holder != 0 {
+		return lockHeld("lock-denied", target, holder)
+	}
+	s.locks[target] = id
+	return nil
+}
+
+func (s *Simulator) unlock(id int, target string) *RPCError {
+	if holder := s.locks[target]; holder != id {
+		return &RPCError{Type: errorTypeProtocol, Tag: "operation-failed", Message: target + " is not locked by this session"}
+	}
+	delete(s.locks, target)
+	return nil
+}
+
+func (s *Simulator) killSession(id int, operation *etree.Element) *RPCError {
+	sessionID := 0
+	if e := operation.SelectElement("session-id"); e != nil {
+		sessionID, _ = strconv.Atoi(strings.TrimSpace(e.Text()))
+	}
+	session, present := s.sessions[sessionID]
+	if !present || sessionID == id {
+		return &RPCError{Type: errorTypeProtocol, Tag: "invalid-value", Message: "session-id " + strconv.Itoa(sessionID) + " cannot be killed"}
+	}
+	// the session releases its locks as it ends, they are released here so they are not held after the reply
+	for datastore, holder := range s.locks {
+		if holder == sessionID {
+			delete(s.locks, datastore)
+		}
+	}
+	// nolint
+	session.Close()
+	return nil
+}
+
+// datastoreName returns the datastore named by a source or target element of an operation
+func datastoreName(operation *etree.Element, tag string) (string, *RPCError) {
+	e := operation.SelectElement(tag)
+	if e == nil || len(e.ChildElements()) == 0 {
+		return "", &RPCError{Type: errorTypeProtocol, Tag: "missing-element", Message: operation.Tag + " does not have a " + tag}
+	}
+	name := e.ChildElements()[0].Tag
+	if name != Running && name != Candidate {
+		return "", &RPCError{Type: errorTypeProtocol, Tag: "invalid-value", Message: name + " is not a datastore served by the simulator"}
+	}
+	return name, nil
+}
+
+// RPCError is an <rpc-error> returned in place of the contents of a reply, RFC 6241 section 4.3. The type defaults to
+// application and the severity to error
+type RPCError struct {
+	Type      string `yaml:"type,omitempty"`
+	Tag       string `yaml:"tag"`
+	Severity  string `yaml:"severity,omitempty"`
+	AppTag    string `yaml:"apptag,omitempty"`
+	Path      string `yaml:"path,omitempty"`
+	Message   string `yaml:"message,omitempty"`
+	SessionID int    `yaml:"-"` // the session holding a lock, reported as error-info
+}
+
+func (e *RPCError) element() *etree.Element {
+	element := etree.NewElement("rpc-error")
+	element.CreateElement("error-type").SetText(valueOrDefault(e.Type, errorTypeApplication))
+	element.CreateElement("error-tag").SetText(e.Tag)
+	element.CreateElement("error-severity").SetText(valueOrDefault(e.Severity, "error"))
+	if e.AppTag != "" {
+		element.CreateElement("error-app-tag").SetText(e.AppTag)
+	}
+	if e.Path != "" {
+		element.CreateElement("error-path").SetText(e.Path)
+	}
+	if e.Message != "" {
+		message := element.CreateElement("error-message")
+		message.CreateAttr("xml:lang", "en")
+		message.SetText(e.Message)
+	}
+	if e.SessionID != 0 {
+		element.CreateElement("error-info").CreateElement("session-id").SetText(strconv.Itoa(e.SessionID))
+	}
+	return element
+}
+
+func valueOrDefault(value, dflt string) string {
+	if value == "" {
+		return dflt
+	}
+	return value
+}
+
+// lockHeld returns the error for a datastore locked by another session
+func lockHeld(tag, datastore string, holder int) *RPCError {
+	return &RPCError{Type: errorTypeProtocol, Tag: tag, Message: datastore + " is locked by session " + strconv.Itoa(holder), SessionID: holder}
+}
+
+// rpcReply returns an <rpc-reply> to a request holding either the contents or an error, the attributes of the request
+// (including the message-id) are returned in the reply
+func rpcReply(request *etree.Element, contents []*etree.Element, rerr *RPCError) []byte {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	reply := doc.CreateElement("rpc-reply")
+	if request != nil {
+		reply.Attr = append(reply.Attr, request.Attr...)
+	}
+	if reply.SelectAttr("xmlns") == nil {
+		reply.CreateAttr("xmlns", baseNamespace)
+	}
+	if rerr != nil {
+		reply.AddChild(rerr.element())
+	} else {
+		for _, e := range contents {
+			reply.AddChild(e)
+		}
+	}
+	// nolint
+	bytes, _ := doc.WriteToBytes()
+	return bytes
+}
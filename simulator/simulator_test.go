@@ -0,0 +1,284 @@
+package simulator
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Juniper/go-netconf/netconf"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// serve starts a simulator with the test datastore and rules, followed by any rules provided, on a local port returning
+// the simulator, the ssh config to connect with, the address and a function to stop it
+func serve(t *testing.T, extra ...Rule) (*Simulator, *ssh.ClientConfig, string, func()) {
+	hostKey, err := NewHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := New("admin", "secret", hostKey)
+	if err = sim.LoadDatastore("testdata/datastore.xml"); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules("testdata/rules.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sim.AddRules(append(rules.Rules, extra...)...); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nolint
+	go sim.Serve(listener)
+	config := &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+	}
+	// nolint
+	return sim, config, listener.Addr().String(), func() { listener.Close() }
+}
+
+// errorTag returns the error-tag of an rpc-error returned by Exec
+func errorTag(err error) string {
+	if rpcErr, ok := err.(*netconf.RPCError); ok {
+		return rpcErr.Tag
+	}
+	return ""
+}
+
+func Test_Simulator(t *testing.T) {
+	_, config, address, stop := serve(t)
+	defer stop()
+
+	session, err := netconf.DialSSH(address, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	assert.True(t, session.SessionID > 0)
+	assert.Contains(t, session.ServerCapabilities, base11Capability)
+	assert.Contains(t, session.ServerCapabilities, candidateCapability)
+
+	t.Run("get-config returns the datastore loaded", func(t *testing.T) {
+		reply, err := session.Exec(netconf.MethodGetConfig("running"))
+		assert.Nil(t, err)
+		assert.Contains(t, reply.Data, "<name>eth0</name>")
+		assert.Contains(t, reply.Data, "<hostname>simulator</hostname>")
+	})
+	t.Run("get with a subtree filter", func(t *testing.T) {
+		reply, err := session.Exec(netconf.RawMethod(`<get><filter type="subtree"><interfaces><interface><name>eth1</name></interface></interfaces></filter></get>`))
+		assert.Nil(t, err)
+		assert.Contains(t, reply.Data, "<name>eth1</name>")
+		assert.NotContains(t, reply.Data, "eth0")
+		assert.NotContains(t, reply.Data, "hostname")
+	})
+	t.Run("edit-config of the candidate is applied to running on commit", func(t *testing.T) {
+		edit := `<edit-config><target><candidate/></target><config><interfaces><interface><name>eth1</name><enabled>true</enabled></interface></interfaces></config></edit-config>`
+		filter := `<get-config><source><running/></source><filter><interfaces><interface><name>eth1</name></interface></interfaces></filter></get-config>`
+		_, err := session.Exec(netconf.RawMethod(edit))
+		assert.Nil(t, err)
+		reply, err := session.Exec(netconf.RawMethod(filter))
+		assert.Nil(t, err)
+		assert.Contains(t, reply.Data, "<enabled>false</enabled>")
+		_, err = session.Exec(netconf.RawMethod("<commit/>"))
+		assert.Nil(t, err)
+		reply, err = session.Exec(netconf.RawMethod(filter))
+		assert.Nil(t, err)
+		assert.Contains(t, reply.Data, "<enabled>true</enabled>")
+	})
+	t.Run("a lock is denied while held by another session", func(t *testing.T) {
+		other, err := netconf.DialSSH(address, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = session.Exec(netconf.MethodLock("candidate"))
+		assert.Nil(t, err)
+		_, err = other.Exec(netconf.MethodLock("candidate"))
+		assert.Equal(t, "lock-denied", errorTag(err))
+		_, err = other.Exec(netconf.RawMethod(`<edit-config><target><candidate/></target><config><system/></config></edit-config>`))
+		assert.Equal(t, "in-use", errorTag(err))
+		// the lock is released when the session holding it ends
+		other.Close()
+		_, err = session.Exec(netconf.MethodUnlock("candidate"))
+		assert.Nil(t, err)
+	})
+	t.Run("rules answer RPCs before the operations implemented", func(t *testing.T) {
+		reply, err := session.Exec(netconf.RawMethod(`<get-schema xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"><identifier>ietf-interfaces</identifier></get-schema>`))
+		assert.Nil(t, err)
+		assert.Contains(t, reply.Data, "module ietf-interfaces {}")
+		reply, err = session.Exec(netconf.RawMethod(`<reboot xmlns="urn:example:system"/>`))
+		assert.Nil(t, err)
+		assert.Contains(t, reply.Data, "<ok/>")
+	})
+	t.Run("unsupported operations are rejected", func(t *testing.T) {
+		_, err := session.Exec(netconf.RawMethod(`<get-schema><identifier>ietf-system</identifier></get-schema>`))
+		assert.Equal(t, "operation-not-supported", errorTag(err))
+	})
+	t.Run("close-session ends the session", func(t *testing.T) {
+		_, err := session.Exec(netconf.RawMethod("<close-session/>"))
+		assert.Nil(t, err)
+		_, err = session.Exec(netconf.MethodGetConfig("running"))
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_SimulatorAuthentication(t *testing.T) {
+	_, config, address, stop := serve(t)
+	defer stop()
+	config.Auth = []ssh.AuthMethod{ssh.Password("wrong")}
+	_, err := netconf.DialSSH(address, config)
+	assert.NotNil(t, err)
+}
+
+// readWriter joins the stdout and stdin of an ssh session
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+func Test_SimulatorChunkedFraming(t *testing.T) {
+	_, config, address, stop := serve(t)
+	defer stop()
+
+	client, err := ssh.Dial("tcp", address, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, _ := session.StdinPipe()
+	reader, _ := session.StdoutPipe()
+	if err = session.RequestSubsystem(sshNetconfSubsystem); err != nil {
+		t.Fatal(err)
+	}
+	tr := newTransport(readWriter{reader, writer})
+
+	hello, err := tr.Receive()
+	assert.Nil(t, err)
+	assert.Contains(t, string(hello), base11Capability)
+	assert.Nil(t, tr.Send([]byte(`<hello xmlns="`+baseNamespace+`"><capabilities><capability>`+base11Capability+`</capability></capabilities></hello>`)))
+
+	// both peers advertised base:1.1 so messages are chunked from here on
+	tr.chunked = true
+	assert.Nil(t, tr.Send([]byte(`<rpc message-id="101" xmlns="`+baseNamespace+`"><get-config><source><running/></source></get-config></rpc>`)))
+	reply, err := tr.Receive()
+	assert.Nil(t, err)
+	assert.Contains(t, string(reply), `message-id="101"`)
+	assert.Contains(t, string(reply), "<name>eth0</name>")
+}
+
+func Test_LoadRules(t *testing.T) {
+	rules, err := LoadRules("testdata/rules.yml")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, rules.MaxSessions)
+	assert.Equal(t, 3, len(rules.Rules))
+	assert.Equal(t, "testdata/schema.xml", rules.Rules[0].ReplyFile)
+	assert.Equal(t, &RPCError{Tag: "invalid-value", AppTag: "interface-not-found", Path: "/interfaces/interface[name='eth9']", Message: "eth9 does not exist"}, rules.Rules[2].Error)
+
+	_, err = LoadRules("testdata/missing.yml")
+	assert.NotNil(t, err)
+}
+
+func Test_RuleCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		err  string
+	}{
+		{"reply", Rule{Reply: "<data/><data/>"}, ""},
+		{"invalid reply", Rule{Reply: "<data type=x/>"}, "rule reply is not valid xml: "},
+		{"invalid match", Rule{Match: "("}, "error parsing regexp: "},
+		{"negative latency", Rule{Latency: -1}, "rule latency and jitter cannot be negative"},
+		{"drop and malformed", Rule{Drop: true, Malformed: true}, "rule cannot both drop and malform a reply"},
+		{"reply and error", Rule{Reply: "<ok/>", Error: &RPCError{Tag: "in-use"}}, "rule cannot have both a reply and an error"},
+		{"error without a tag", Rule{Error: &RPCError{}}, "rule error must have a tag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.compile()
+			if tt.err == "" {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func Test_SimulatorFaults(t *testing.T) {
+	_, config, address, stop := serve(t)
+	defer stop()
+
+	t.Run("rpc-error replies", func(t *testing.T) {
+		session, err := netconf.DialSSH(address, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer session.Close()
+		start := time.Now()
+		_, err = session.Exec(netconf.RawMethod(`<edit-config><target><running/></target><config><interfaces><interface><name>eth9</name></interface></interfaces></config></edit-config>`))
+		assert.True(t, time.Since(start) >= 10*time.Millisecond)
+		if assert.IsType(t, &netconf.RPCError{}, err) {
+			rpcErr := err.(*netconf.RPCError)
+			assert.Equal(t, "application", rpcErr.Type)
+			assert.Equal(t, "invalid-value", rpcErr.Tag)
+			assert.Equal(t, "error", rpcErr.Severity)
+			assert.Equal(t, "/interfaces/interface[name='eth9']", rpcErr.Path)
+			assert.Equal(t, "eth9 does not exist", rpcErr.Message)
+		}
+	})
+
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"drop the channel mid reply", Rule{Operation: "commit", Drop: true}},
+		{"malformed framing", Rule{Operation: "commit", Malformed: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, config, address, stop := serve(t, tt.rule)
+			defer stop()
+			session, err := netconf.DialSSH(address, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.Close()
+			_, err = session.Exec(netconf.RawMethod("<get/>"))
+			assert.Nil(t, err)
+			_, err = session.Exec(netconf.RawMethod("<commit/>"))
+			assert.NotNil(t, err)
+		})
+	}
+
+	t.Run("sessions beyond the limit are refused", func(t *testing.T) {
+		sim, config, address, stop := serve(t)
+		defer stop()
+		sim.SetMaxSessions(1)
+		session, err := netconf.DialSSH(address, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = netconf.DialSSH(address, config)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "resource shortage")
+		}
+		// a session can be established once another ends
+		session.Close()
+		time.Sleep(50 * time.Millisecond)
+		session, err = netconf.DialSSH(address, config)
+		assert.Nil(t, err)
+		session.Close()
+	})
+}
@@ -0,0 +1,112 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// msgSeparator is the NETCONF 1.0 end-of-message delimiter
+const msgSeparator = "]]>]]>"
+
+// transport implements the agents side of NETCONF framing over the netconf subsystem channel, end-of-message framing
+// is used until both peers have advertised base:1.1 in their hello, chunked framing after
+type transport struct {
+	rw      io.ReadWriter
+	reader  *bufio.Reader
+	chunked bool
+}
+
+func newTransport(rw io.ReadWriter) *transport {
+	return &transport{rw: rw, reader: bufio.NewReader(rw)}
+}
+
+// Send writes a message framed for the current framing mode
+func (t *transport) Send(data []byte) error {
+	_, err := t.rw.Write(t.frame(data))
+	return err
+}
+
+// SendPartial writes the first half of a framed message, as though the connection failed while it was being sent
+func (t *transport) SendPartial(data []byte) error {
+	framed := t.frame(data)
+	_, err := t.rw.Write(framed[:len(framed)/2])
+	return err
+}
+
+// SendMalformed writes a message with framing that cannot be parsed, the end-of-message delimiter is truncated or the
+// chunk size is zero. A peer cannot recover from a framing error so the session is to be closed after
+func (t *transport) SendMalformed(data []byte) error {
+	var framed []byte
+	if t.chunked {
+		framed = append(append([]byte("\n#0\n"), data...), []byte("\n##\n")...)
+	} else {
+		framed = append(append(data, []byte(msgSeparator[:len(msgSeparator)-1])...), '\n')
+	}
+	_, err := t.rw.Write(framed)
+	return err
+}
+
+// frame returns a message framed for the current framing mode
+func (t *transport) frame(data []byte) []byte {
+	if t.chunked {
+		framed := append([]byte(fmt.Sprintf("\n#%d\n", len(data))), data...)
+		return append(framed, []byte("\n##\n")...)
+	}
+	return append(append(data, []byte(msgSeparator)...), '\n')
+}
+
+// Receive reads a message framed for the current framing mode, returning the message without the framing
+func (t *transport) Receive() ([]byte, error) {
+	if t.chunked {
+		return t.receiveChunked()
+	}
+	var message []byte
+	for {
+		chunk, err := t.reader.ReadBytes('>')
+		message = append(message, chunk...)
+		if bytes.HasSuffix(message, []byte(msgSeparator)) {
+			return bytes.TrimSpace(message[:len(message)-len(msgSeparator)]), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// receiveChunked reads chunks until the end-of-chunks marker, RFC 6242 section 4.2
+func (t *transport) receiveChunked() ([]byte, error) {
+	var message []byte
+	for {
+		header, err := t.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		// the line feed preceding a chunk header is read as an empty line, as is the one following the end-of-message
+		// delimiter of the hello
+		for header == "\n" {
+			if header, err = t.reader.ReadString('\n'); err != nil {
+				return nil, err
+			}
+		}
+		if header == "##\n" {
+			return message, nil
+		}
+		if len(header) < 3 || header[0] != '#' {
+			return nil, errors.New("malformed chunk header")
+		}
+		// chunk sizes are at most 4294967295 octets
+		size, err := strconv.ParseUint(header[1:len(header)-1], 10, 32)
+		if err != nil || size == 0 {
+			return nil, errors.New("malformed chunk size")
+		}
+		chunk := make([]byte, size)
+		if _, err = io.ReadFull(t.reader, chunk); err != nil {
+			return nil, err
+		}
+		message = append(message, chunk...)
+	}
+}
@@ -3,9 +3,11 @@ package suite
 import (
 	"errors"
 	"io/ioutil"
-	"log"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/beevik/etree"
 	"github.com/tdewolff/minify"
@@ -13,15 +15,52 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
-// Sshconfig defines a definition for the parameters required to connect to a NETCONF Agent via SSH
+// Sshconfig defines a definition for the parameters required to connect to a NETCONF Agent via SSH, or TLS when
+// transport is tls
 type Sshconfig struct {
 	Hostname        string `json:"hostname" yaml:"hostname"`
 	Port            int    `json:"port" yaml:"port"`
 	Username        string `json:"username" yaml:"username"`
 	Password        string `json:"password" yaml:"password"`
 	Reuseconnection bool   `json:"reuseconnection" yaml:"reuseconnection"`
+	Transport       string `json:"transport,omitempty" yaml:"transport,omitempty"`
+	// ssh authentication methods that can be used in place of or as well as a password, agent is the path to the
+	// ssh-agent socket (for e.g. $SSH_AUTH_SOCK) and keyboardinteractive the answers to the agents prompts in order
+	PrivateKey          string   `json:"privatekey,omitempty" yaml:"privatekey,omitempty"`
+	Passphrase          string   `json:"passphrase,omitempty" yaml:"passphrase,omitempty"`
+	Agent               string   `json:"agent,omitempty" yaml:"agent,omitempty"`
+	KeyboardInteractive []string `json:"keyboardinteractive,omitempty" yaml:"keyboardinteractive,omitempty"`
+	// ssh host key verification, the agents key is checked against a pinned fingerprint (for e.g. SHA256:...) or a
+	// known_hosts file, $HOME/.ssh/known_hosts if neither is defined, insecure disables verification
+	KnownHosts  string `json:"knownhosts,omitempty" yaml:"knownhosts,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Insecure    bool   `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	// tls transport parameters, paths to PEM encoded files
+	CA          string `json:"ca,omitempty" yaml:"ca,omitempty"`
+	Certificate string `json:"certificate,omitempty" yaml:"certificate,omitempty"`
+	Key         string `json:"key,omitempty" yaml:"key,omitempty"`
+	// seconds allowed to connect to the agent and complete the handshake and hello exchange, defaults to
+	// DefaultConnectTimeout
+	ConnectTimeout int `json:"connecttimeout,omitempty" yaml:"connecttimeout,omitempty"`
 }
 
+// DefaultConnectTimeout is the number of seconds allowed to establish a session when connecttimeout is not defined
+const DefaultConnectTimeout = 30
+
+// GetConnectTimeout returns the time allowed to establish a session, defaulting to DefaultConnectTimeout
+func (c *Sshconfig) GetConnectTimeout() time.Duration {
+	if c.ConnectTimeout == 0 {
+		return DefaultConnectTimeout * time.Second
+	}
+	return time.Duration(c.ConnectTimeout) * time.Second
+}
+
+// Supported transports, ssh is used when a transport is not defined
+const (
+	TransportSSH = "ssh"
+	TransportTLS = "tls"
+)
+
 // Filter defines the parameters required to generate a subtree or xpath filter within a NETCONF Request
 type Filter struct {
 	Type   string  `json:"type" yaml:"type"`
@@ -29,18 +68,116 @@ type Filter struct {
 	Select string  `json:"select" yaml:"select"`
 }
 
+// Assert is a check of the reply to a netconf action. Path is an etree path (a subset of XPath, see
+// https://godoc.org/github.com/beevik/etree#Path) selecting elements of the rpc-reply, prefixes in the path identify
+// namespaces by the URIs declared in namespaces rather than by the prefixes the agent used, a tag without a prefix
+// matches the tag in any namespace. An assertion checks one of; that elements are selected or not (exists), the number
+// selected (count), the text of each selected (equals) or a numeric comparison of the text of each selected (compare,
+// for e.g. ">= 1500"). Without a check the assertion is that elements are selected
+type Assert struct {
+	Path       string            `json:"path" yaml:"path"`
+	Namespaces map[string]string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	Exists     *bool             `json:"exists,omitempty" yaml:"exists,omitempty"`
+	Count      *int              `json:"count,omitempty" yaml:"count,omitempty"`
+	Equals     *string           `json:"equals,omitempty" yaml:"equals,omitempty"`
+	Compare    *string           `json:"compare,omitempty" yaml:"compare,omitempty"`
+}
+
+// comparison operators supported by an assertions compare, longer operators first so that they are matched first
+var comparisonOperators = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// Comparison returns the operator and the value of an assertions compare
+func (a *Assert) Comparison() (string, float64, error) {
+	if a.Compare == nil {
+		return "", 0, errors.New("assert: compare is not defined")
+	}
+	compare := strings.TrimSpace(*a.Compare)
+	for _, operator := range comparisonOperators {
+		if strings.HasPrefix(compare, operator) {
+			value, err := strconv.ParseFloat(strings.TrimSpace(compare[len(operator):]), 64)
+			if err != nil {
+				break
+			}
+			return operator, value, nil
+		}
+	}
+	return "", 0, errors.New("assert: compare must be an operator (" + strings.Join(comparisonOperators, ", ") + ") followed by a number")
+}
+
 // Netconf struct contains information required to construct a valid NETCONF Operation.
 // Addresses are used to indicate optional content
 type Netconf struct {
-	Hostname  string  `json:"hostname" yaml:"hostname"`
-	Message   *string `json:"message,omitempty" yaml:"message,omitempty"`
-	Method    *string `json:"method,omitempty" yaml:"method,omitempty"`
-	Operation *string `json:"operation,omitempty" yaml:"operation,omitempty"`
-	Source    *string `json:"source,omitempty" yaml:"source,omitempty"`
-	Target    *string `json:"target,omitempty" yaml:"target,omitempty"`
-	Filter    *Filter `json:"filter,omitempty" yaml:"filter,omitempty"`
-	Config    *string `json:"config,omitempty" yaml:"config,omitempty"`
-	Expected  *string `json:"expected,omitempty" yaml:"expected,omitempty"`
+	Hostname  string   `json:"hostname" yaml:"hostname"`
+	Message   *string  `json:"message,omitempty" yaml:"message,omitempty"`
+	Method    *string  `json:"method,omitempty" yaml:"method,omitempty"`
+	Operation *string  `json:"operation,omitempty" yaml:"operation,omitempty"`
+	Source    *string  `json:"source,omitempty" yaml:"source,omitempty"`
+	Target    *string  `json:"target,omitempty" yaml:"target,omitempty"`
+	Filter    *Filter  `json:"filter,omitempty" yaml:"filter,omitempty"`
+	Config    *string  `json:"config,omitempty" yaml:"config,omitempty"`
+	Expected  *string  `json:"expected,omitempty" yaml:"expected,omitempty"`
+	Assert    []Assert `json:"assert,omitempty" yaml:"assert,omitempty"`
+	// get and get-config default value reporting (RFC 6243)
+	WithDefaults *string `json:"with-defaults,omitempty" yaml:"with-defaults,omitempty"`
+	// edit-config parameters, url is sent instead of inline config (:url capability)
+	DefaultOperation *string `json:"default-operation,omitempty" yaml:"default-operation,omitempty"`
+	TestOption       *string `json:"test-option,omitempty" yaml:"test-option,omitempty"`
+	ErrorOption      *string `json:"error-option,omitempty" yaml:"error-option,omitempty"`
+	URL              *string `json:"url,omitempty" yaml:"url,omitempty"`
+	// commit and cancel-commit parameters (:candidate and :confirmed-commit capabilities)
+	Confirmed      *bool   `json:"confirmed,omitempty" yaml:"confirmed,omitempty"`
+	ConfirmTimeout *int    `json:"confirm-timeout,omitempty" yaml:"confirm-timeout,omitempty"` // seconds
+	Persist        *string `json:"persist,omitempty" yaml:"persist,omitempty"`
+	PersistID      *string `json:"persist-id,omitempty" yaml:"persist-id,omitempty"`
+	// kill-session parameters, the session-id of the session to kill or the index of the client (from 0) whose session
+	// to the same host is killed, resolved when the request is sent. The client must reuse its connection
+	SessionID     *int `json:"session-id,omitempty" yaml:"session-id,omitempty"`
+	SessionClient *int `json:"session-client,omitempty" yaml:"session-client,omitempty"`
+	// get-data and edit-data parameters (NMDA, RFC 8526)
+	Datastore    *string `json:"datastore,omitempty" yaml:"datastore,omitempty"`
+	ConfigFilter *bool   `json:"config-filter,omitempty" yaml:"config-filter,omitempty"`
+	MaxDepth     *int    `json:"max-depth,omitempty" yaml:"max-depth,omitempty"`
+	WithOrigin   *bool   `json:"with-origin,omitempty" yaml:"with-origin,omitempty"`
+	// create-subscription (RFC 5277) and establish-subscription (RFC 8639, RFC 8641 when a datastore is defined)
+	// parameters, listen is how long the session should receive notifications for after subscribing
+	Stream    *string `json:"stream,omitempty" yaml:"stream,omitempty"`
+	StartTime *string `json:"start-time,omitempty" yaml:"start-time,omitempty"`
+	StopTime  *string `json:"stop-time,omitempty" yaml:"stop-time,omitempty"`
+	Period    *int    `json:"period,omitempty" yaml:"period,omitempty"` // centiseconds
+	OnChange  *bool   `json:"on-change,omitempty" yaml:"on-change,omitempty"`
+	Listen    *int    `json:"listen,omitempty" yaml:"listen,omitempty"` // milliseconds
+}
+
+const (
+	nmdaNamespace         = "urn:ietf:params:xml:ns:yang:ietf-netconf-nmda"
+	datastoresNamespace   = "urn:ietf:params:xml:ns:yang:ietf-datastores"
+	withDefaultsNamespace = "urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults"
+	notificationNamespace = "urn:ietf:params:xml:ns:netconf:notification:1.0"
+	subscribedNamespace   = "urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications"
+	yangPushNamespace     = "urn:ietf:params:xml:ns:yang:ietf-yang-push"
+)
+
+// DefaultStream is the event stream subscribed to when a stream is not defined
+const DefaultStream = "NETCONF"
+
+// YangPushStream is used to identify notifications received from a datastore subscription
+const YangPushStream = "yang-push"
+
+// IsSubscription returns true if the operation subscribes the session to notifications
+func (n *Netconf) IsSubscription() bool {
+	return n.Operation != nil && (*n.Operation == "create-subscription" || *n.Operation == "establish-subscription")
+}
+
+// SubscribedStream returns the name of the stream the subscription will receive notifications from
+func (n *Netconf) SubscribedStream() string {
+	switch {
+	case n.Stream != nil:
+		return *n.Stream
+	case n.Datastore != nil:
+		return YangPushStream
+	default:
+		return DefaultStream
+	}
 }
 
 // Sleep is an action instructing the client to sleep for the period defined in duration
@@ -73,12 +210,92 @@ func (c Configs) IsReuseConnection(hostname string) bool {
 	return false
 }
 
+// Transport iterates through the Config slice and matches on host returning the transport used to connect to it
+func (c Configs) Transport(hostname string) string {
+	for idx := range c {
+		if c[idx].Hostname == hostname && c[idx].Transport != "" {
+			return c[idx].Transport
+		}
+	}
+	return TransportSSH
+}
+
+// Rate defines an open model load, arrivals are scheduled at the target rate regardless of how quickly the agent
+// replies rather than each client waiting for a reply before its next request. An arrival is an iteration of the
+// blocks or, with unit rpc, a single netconf action; workers are added as needed up to maxworkers
+type Rate struct {
+	Target     float64 `json:"target" yaml:"target"` // arrivals per second
+	Unit       string  `json:"unit,omitempty" yaml:"unit,omitempty"`
+	MaxWorkers int     `json:"maxworkers,omitempty" yaml:"maxworkers,omitempty"`
+}
+
+// Supported rate units, iteration is used when a unit is not defined
+const (
+	RateUnitIteration = "iteration"
+	RateUnitRPC       = "rpc"
+)
+
+// DefaultMaxWorkers is the number of workers a rate is limited to when maxworkers is not defined
+const DefaultMaxWorkers = 100
+
+// GetUnit returns the unit of the rate, defaulting to iteration
+func (r *Rate) GetUnit() string {
+	if r.Unit == "" {
+		return RateUnitIteration
+	}
+	return r.Unit
+}
+
+// GetMaxWorkers returns the maximum number of workers, defaulting to DefaultMaxWorkers
+func (r *Rate) GetMaxWorkers() int {
+	if r.MaxWorkers == 0 {
+		return DefaultMaxWorkers
+	}
+	return r.MaxWorkers
+}
+
+// Stage is a step in a load profile, it sets the number of clients or, for an open model, the target rate for its
+// duration. With ramp the clients or rate change linearly from the previous stages target (zero for the first stage)
+// over the duration, otherwise the target applies for the whole of the stage
+type Stage struct {
+	Name     string  `json:"name,omitempty" yaml:"name,omitempty"`
+	Clients  int     `json:"clients,omitempty" yaml:"clients,omitempty"`
+	Rate     float64 `json:"rate,omitempty" yaml:"rate,omitempty"`
+	Duration int     `json:"duration" yaml:"duration"` // seconds
+	Ramp     bool    `json:"ramp,omitempty" yaml:"ramp,omitempty"`
+}
+
+// StageLabel returns the name of a stage, or its position in the profile (starting at 1) if not named
+func (ts *TestSuite) StageLabel(stage int) string {
+	if stage < 1 || stage > len(ts.Stages) {
+		return ""
+	}
+	if ts.Stages[stage-1].Name != "" {
+		return ts.Stages[stage-1].Name
+	}
+	return strconv.Itoa(stage)
+}
+
+// IsRateStages returns true if the stages define target rates rather than clients
+func (ts *TestSuite) IsRateStages() bool {
+	for _, stage := range ts.Stages {
+		if stage.Rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // TestSuite is the top level struct for the yaml document definition
 type TestSuite struct {
 	File       string  `json:"-" yaml:"-"`
 	Iterations int     `json:"iterations" yaml:"iterations"`
 	Clients    int     `json:"clients" yaml:"clients"`
 	Rampup     int     `json:"rampup" yaml:"rampup"`
+	Duration   int     `json:"duration,omitempty" yaml:"duration,omitempty"` // seconds, iterations are unlimited if not defined
+	Pacing     int     `json:"pacing,omitempty" yaml:"pacing,omitempty"`     // milliseconds between the start of a clients iterations
+	Rate       *Rate   `json:"rate,omitempty" yaml:"rate,omitempty"`
+	Stages     []Stage `json:"stages,omitempty" yaml:"stages,omitempty"`
 	Configs    Configs `json:"configs" yaml:"configs"`
 	Blocks     []Block `json:"blocks" yaml:"blocks"`
 }
@@ -121,7 +338,8 @@ func InlineXML(ts *TestSuite) error {
 		for _, action := range block.Actions {
 			switch {
 			case action.Netconf != nil && action.Netconf.Operation != nil:
-				if *action.Netconf.Operation == "edit-config" {
+				switch *action.Netconf.Operation {
+				case "edit-config", "copy-config", "edit-data":
 					err = handleSnippet(action.Netconf.Config, m)
 				}
 			case action.Netconf != nil && action.Netconf.Message != nil:
@@ -197,62 +415,263 @@ func handleMessage(n *Netconf, doc *etree.Document) error {
 }
 
 func handleOperation(n *Netconf, doc *etree.Document) error {
+	if err := validateOperation(n); err != nil {
+		return err
+	}
 	operation := doc.CreateElement(*n.Operation)
 	switch *n.Operation {
 	case "get-config":
-		source := operation.CreateElement("source")
-		if n.Source != nil {
-			source.CreateElement(*n.Source)
-		} else {
-			source.CreateElement("running")
+		addDatastore(operation, "source", n.Source, "running")
+		if err := addFilterIfPresent(n, operation); err != nil {
+			return err
 		}
-		addFilterIfPresent(n, operation)
+		addWithDefaultsIfPresent(n, operation)
 		return nil
 	case "get":
-		addFilterIfPresent(n, operation)
+		if err := addFilterIfPresent(n, operation); err != nil {
+			return err
+		}
+		addWithDefaultsIfPresent(n, operation)
+		return nil
+	case "lock", "unlock":
+		addDatastore(operation, "target", n.Target, "running")
+		return nil
+	case "validate":
+		addDatastore(operation, "source", n.Source, "candidate")
+		return nil
+	case "commit":
+		addCommitParameters(n, operation)
+		return nil
+	case "cancel-commit":
+		if n.PersistID != nil {
+			operation.CreateElement("persist-id").SetText(*n.PersistID)
+		}
+		return nil
+	case "discard-changes":
 		return nil
 	case "edit-config":
-		source := operation.CreateElement("target")
-		if n.Target != nil {
-			source.CreateElement(*n.Target)
-		} else {
-			source.CreateElement("running")
+		addDatastore(operation, "target", n.Target, "running")
+		addOptionIfPresent(operation, "default-operation", n.DefaultOperation)
+		addOptionIfPresent(operation, "test-option", n.TestOption)
+		addOptionIfPresent(operation, "error-option", n.ErrorOption)
+		if n.URL != nil {
+			operation.CreateElement("url").SetText(*n.URL)
+			return nil
 		}
 		config := operation.CreateElement("config")
+		return addConfigIfPresent(n, config)
+	case "copy-config":
+		addDatastoreOrURL(operation, "target", *n.Target)
 		if n.Config != nil {
-			inner := etree.NewDocument()
-			err := inner.ReadFromString(*n.Config)
-			if err != nil {
-				log.Println("Config data is not valid xml")
-			}
-			config.AddChild(inner.Root().Copy())
+			config := operation.CreateElement("source").CreateElement("config")
+			return addConfigIfPresent(n, config)
+		}
+		addDatastoreOrURL(operation, "source", *n.Source)
+		return nil
+	case "delete-config":
+		addDatastoreOrURL(operation, "target", *n.Target)
+		return nil
+	case "kill-session":
+		if n.SessionID == nil {
+			return errors.New("netconf: kill-session session-client has not been resolved to a session-id")
+		}
+		operation.CreateElement("session-id").SetText(strconv.Itoa(*n.SessionID))
+		return nil
+	case "close-session":
+		return nil
+	case "get-data":
+		addNMDADatastore(n, operation)
+		if err := addNMDAFilterIfPresent(n, operation); err != nil {
+			return err
+		}
+		if n.ConfigFilter != nil {
+			operation.CreateElement("config-filter").SetText(strconv.FormatBool(*n.ConfigFilter))
+		}
+		if n.MaxDepth != nil {
+			operation.CreateElement("max-depth").SetText(strconv.Itoa(*n.MaxDepth))
+		}
+		if n.WithOrigin != nil && *n.WithOrigin {
+			operation.CreateElement("with-origin")
 		}
+		// get-data uses the with-defaults grouping (RFC 8526), so the parameter is in the NMDA namespace of the operation
+		addOptionIfPresent(operation, "with-defaults", n.WithDefaults)
+		return nil
+	case "edit-data":
+		addNMDADatastore(n, operation)
+		addOptionIfPresent(operation, "default-operation", n.DefaultOperation)
+		config := operation.CreateElement("config")
+		return addConfigIfPresent(n, config)
+	case "create-subscription":
+		operation.CreateAttr("xmlns", notificationNamespace)
+		addOptionIfPresent(operation, "stream", n.Stream)
+		if err := addFilterIfPresent(n, operation); err != nil {
+			return err
+		}
+		addOptionIfPresent(operation, "startTime", n.StartTime)
+		addOptionIfPresent(operation, "stopTime", n.StopTime)
+		return nil
+	case "establish-subscription":
+		operation.CreateAttr("xmlns", subscribedNamespace)
+		if n.Datastore != nil {
+			return addYangPushParameters(n, operation)
+		}
+		operation.CreateElement("stream").SetText(n.SubscribedStream())
+		if err := addPrefixedFilterIfPresent(n, operation, "stream"); err != nil {
+			return err
+		}
+		addOptionIfPresent(operation, "replay-start-time", n.StartTime)
+		addOptionIfPresent(operation, "stop-time", n.StopTime)
 		return nil
 	default:
 		return errors.New(*n.Operation + " is not a supported operation")
 	}
 }
 
-func addFilterIfPresent(n *Netconf, operation *etree.Element) {
-	if n.Filter != nil {
-		filter := operation.CreateElement("filter")
-		filter.CreateAttr("type", n.Filter.Type)
-		//  https://github.com/beevik/etree/issues/49
+// addDatastore adds a source or target element to the operation, naming the datastore provided or the default if not
+func addDatastore(operation *etree.Element, tag string, datastore *string, defaultDatastore string) {
+	element := operation.CreateElement(tag)
+	if datastore != nil {
+		element.CreateElement(*datastore)
+	} else {
+		element.CreateElement(defaultDatastore)
+	}
+}
+
+// addDatastoreOrURL adds a source or target element to the operation, values containing a scheme (for e.g. ftp://) are
+// treated as a url (:url capability) rather than a datastore name
+func addDatastoreOrURL(operation *etree.Element, tag string, value string) {
+	element := operation.CreateElement(tag)
+	if strings.Contains(value, "://") {
+		element.CreateElement("url").SetText(value)
+	} else {
+		element.CreateElement(value)
+	}
+}
+
+func addConfigIfPresent(n *Netconf, config *etree.Element) error {
+	if n.Config != nil {
 		inner := etree.NewDocument()
-		err := inner.ReadFromString(n.Filter.Select)
-		if err != nil {
-			log.Println("Filter Select is not valid xml")
-		}
-		if n.Filter.Ns != nil {
-			top := filter.CreateElement("top")
-			top.CreateAttr("xmlns", *n.Filter.Ns)
-			top.AddChild(inner.Root().Copy())
-		} else {
-			filter.AddChild(inner.Root().Copy())
+		err := inner.ReadFromString(*n.Config)
+		if err != nil || inner.Root() == nil {
+			return errors.New("config data is not valid xml")
 		}
+		config.AddChild(inner.Root().Copy())
+	}
+	return nil
+}
+
+func addWithDefaultsIfPresent(n *Netconf, operation *etree.Element) {
+	if n.WithDefaults != nil {
+		withDefaults := operation.CreateElement("with-defaults")
+		withDefaults.CreateAttr("xmlns", withDefaultsNamespace)
+		withDefaults.SetText(*n.WithDefaults)
+	}
+}
+
+// addPrefixedFilterIfPresent adds a <prefix>-subtree-filter or <prefix>-xpath-filter as used by the subscription
+// models, in the xpath case the select is the xpath expression
+func addPrefixedFilterIfPresent(n *Netconf, operation *etree.Element, prefix string) error {
+	if n.Filter == nil {
+		return nil
+	}
+	if n.Filter.Type == "xpath" {
+		operation.CreateElement(prefix + "-xpath-filter").SetText(n.Filter.Select)
+		return nil
+	}
+	return addSubtree(n.Filter, operation.CreateElement(prefix+"-subtree-filter"))
+}
+
+func addYangPushParameters(n *Netconf, operation *etree.Element) error {
+	operation.CreateAttr("xmlns:yp", yangPushNamespace)
+	operation.CreateAttr("xmlns:ds", datastoresNamespace)
+	datastore := *n.Datastore
+	if !strings.Contains(datastore, ":") {
+		datastore = "ds:" + datastore
+	}
+	operation.CreateElement("yp:datastore").SetText(datastore)
+	if err := addPrefixedFilterIfPresent(n, operation, "yp:datastore"); err != nil {
+		return err
+	}
+	addOptionIfPresent(operation, "stop-time", n.StopTime)
+	if n.Period != nil {
+		operation.CreateElement("yp:periodic").CreateElement("yp:period").SetText(strconv.Itoa(*n.Period))
+	} else {
+		operation.CreateElement("yp:on-change")
+	}
+	return nil
+}
+
+func addOptionIfPresent(operation *etree.Element, tag string, value *string) {
+	if value != nil {
+		operation.CreateElement(tag).SetText(*value)
 	}
 }
 
+func addCommitParameters(n *Netconf, operation *etree.Element) {
+	if n.Confirmed != nil && *n.Confirmed {
+		operation.CreateElement("confirmed")
+	}
+	if n.ConfirmTimeout != nil {
+		operation.CreateElement("confirm-timeout").SetText(strconv.Itoa(*n.ConfirmTimeout))
+	}
+	if n.Persist != nil {
+		operation.CreateElement("persist").SetText(*n.Persist)
+	}
+	if n.PersistID != nil {
+		operation.CreateElement("persist-id").SetText(*n.PersistID)
+	}
+}
+
+func addFilterIfPresent(n *Netconf, operation *etree.Element) error {
+	if n.Filter == nil {
+		return nil
+	}
+	filter := operation.CreateElement("filter")
+	filter.CreateAttr("type", n.Filter.Type)
+	return addSubtree(n.Filter, filter)
+}
+
+func addSubtree(f *Filter, filter *etree.Element) error {
+	//  https://github.com/beevik/etree/issues/49
+	inner := etree.NewDocument()
+	err := inner.ReadFromString(f.Select)
+	if err != nil || inner.Root() == nil {
+		return errors.New("filter select is not valid xml")
+	}
+	if f.Ns != nil {
+		top := filter.CreateElement("top")
+		top.CreateAttr("xmlns", *f.Ns)
+		top.AddChild(inner.Root().Copy())
+	} else {
+		filter.AddChild(inner.Root().Copy())
+	}
+	return nil
+}
+
+// addNMDADatastore qualifies the operation with the NMDA namespace and adds the datastore identity, datastore names
+// without a prefix are assumed to be defined in ietf-datastores
+func addNMDADatastore(n *Netconf, operation *etree.Element) {
+	operation.CreateAttr("xmlns", nmdaNamespace)
+	operation.CreateAttr("xmlns:ds", datastoresNamespace)
+	datastore := *n.Datastore
+	if !strings.Contains(datastore, ":") {
+		datastore = "ds:" + datastore
+	}
+	operation.CreateElement("datastore").SetText(datastore)
+}
+
+// addNMDAFilterIfPresent adds a subtree-filter or xpath-filter, in the xpath case the select is the xpath expression
+func addNMDAFilterIfPresent(n *Netconf, operation *etree.Element) error {
+	if n.Filter == nil {
+		return nil
+	}
+	if n.Filter.Type == "xpath" {
+		operation.CreateElement("xpath-filter").SetText(n.Filter.Select)
+		return nil
+	}
+	return addSubtree(n.Filter, operation.CreateElement("subtree-filter"))
+}
+
 // GetConfig returns the connection information for a specific host
 func (ts *TestSuite) GetConfig(hostname string) *Sshconfig {
 	for idx := range ts.Configs {
@@ -277,6 +696,18 @@ func validateTestSuite(ts *TestSuite) error {
 	if len(ts.Configs) == 0 {
 		return errors.New("Testsuite should contain at least one SSH Config section")
 	}
+	if ts.Duration < 0 {
+		return errors.New("Testsuite duration cannot be negative")
+	}
+	if ts.Pacing < 0 {
+		return errors.New("Testsuite pacing cannot be negative")
+	}
+	if err := validateRate(ts); err != nil {
+		return err
+	}
+	if err := validateStages(ts); err != nil {
+		return err
+	}
 
 	hosts, err := validateSSHConfig(ts)
 	if err != nil {
@@ -305,6 +736,237 @@ func validateNetconfAction(action Action, hosts []string) error {
 		if !StringInSlice(action.Netconf.Hostname, hosts) {
 			return errors.New("netconf: action has to use a host defined in the configs section")
 		}
+		if action.Netconf.Expected != nil {
+			if _, err := regexp.Compile(*action.Netconf.Expected); err != nil {
+				return errors.New("netconf: expected is not a valid regular expression")
+			}
+		}
+		for idx := range action.Netconf.Assert {
+			if err := validateAssert(&action.Netconf.Assert[idx]); err != nil {
+				return err
+			}
+		}
+		if action.Netconf.Operation != nil {
+			return validateOperation(action.Netconf)
+		}
+	}
+	return nil
+}
+
+// validateOperation checks that the parameters required by an operation are present
+func validateOperation(n *Netconf) error {
+	if n.Listen != nil && (!n.IsSubscription() || *n.Listen <= 0) {
+		return errors.New("netconf: listen must be greater than zero and is only valid on a subscription")
+	}
+	if n.WithDefaults != nil {
+		if *n.Operation != "get" && *n.Operation != "get-config" && *n.Operation != "get-data" {
+			return errors.New("netconf: with-defaults is only valid on get, get-config and get-data")
+		}
+		if err := validateOption("with-defaults", n.WithDefaults, []string{"report-all", "trim", "explicit", "report-all-tagged"}); err != nil {
+			return err
+		}
+	}
+	switch *n.Operation {
+	case "commit":
+		return validateCommit(n)
+	case "copy-config":
+		if n.Target == nil {
+			return errors.New("netconf: copy-config requires a target")
+		}
+		if (n.Source == nil) == (n.Config == nil) {
+			return errors.New("netconf: copy-config requires either a source or an inline config")
+		}
+	case "delete-config":
+		if n.Target == nil || *n.Target == "running" {
+			return errors.New("netconf: delete-config requires a target other than running")
+		}
+	case "kill-session":
+		if (n.SessionID == nil) == (n.SessionClient == nil) {
+			return errors.New("netconf: kill-session requires either a session-id or a session-client")
+		}
+		if n.SessionID != nil && *n.SessionID <= 0 {
+			return errors.New("netconf: kill-session requires a session-id greater than zero")
+		}
+		if n.SessionClient != nil && *n.SessionClient < 0 {
+			return errors.New("netconf: kill-session session-client cannot be negative")
+		}
+	case "edit-config":
+		return validateEditConfig(n)
+	case "get-data", "edit-data":
+		return validateNMDA(n)
+	case "establish-subscription":
+		return validateEstablishSubscription(n)
+	}
+	return nil
+}
+
+func validateAssert(a *Assert) error {
+	if _, err := etree.CompilePath(a.Path); a.Path == "" || err != nil {
+		return errors.New("assert: path " + a.Path + " is not a valid path")
+	}
+	checks := 0
+	for _, defined := range []bool{a.Exists != nil, a.Count != nil, a.Equals != nil, a.Compare != nil} {
+		if defined {
+			checks++
+		}
+	}
+	if checks > 1 {
+		return errors.New("assert: only one of exists, count, equals or compare can be defined")
+	}
+	if a.Count != nil && *a.Count < 0 {
+		return errors.New("assert: count cannot be negative")
+	}
+	if a.Compare != nil {
+		if _, _, err := a.Comparison(); err != nil {
+			return err
+		}
+	}
+	// the prefix of a namespace in the reply is rewritten to the one prefix the assertion declares for it
+	declared := make(map[string]bool, len(a.Namespaces))
+	for prefix, uri := range a.Namespaces {
+		if prefix == "" || strings.Contains(prefix, ":") || uri == "" {
+			return errors.New("assert: namespaces must map a prefix to a namespace URI")
+		}
+		if declared[uri] {
+			return errors.New("assert: namespaces cannot map two prefixes to the same namespace URI")
+		}
+		declared[uri] = true
+	}
+	return nil
+}
+
+func validateEstablishSubscription(n *Netconf) error {
+	if n.Datastore == nil {
+		if n.Period != nil || n.OnChange != nil {
+			return errors.New("netconf: period and on-change require a datastore subscription")
+		}
+		return nil
+	}
+	if n.Stream != nil {
+		return errors.New("netconf: establish-subscription accepts either a stream or a datastore, not both")
+	}
+	if n.StartTime != nil {
+		return errors.New("netconf: start-time is not valid on a datastore subscription")
+	}
+	onChange := n.OnChange != nil && *n.OnChange
+	if (n.Period != nil) == onChange {
+		return errors.New("netconf: a datastore subscription requires either a period or on-change")
+	}
+	if n.Period != nil && *n.Period <= 0 {
+		return errors.New("netconf: period must be greater than zero")
+	}
+	return nil
+}
+
+func validateEditConfig(n *Netconf) error {
+	if n.URL != nil && n.Config != nil {
+		return errors.New("netconf: edit-config accepts either a config or a url, not both")
+	}
+	if err := validateOption("default-operation", n.DefaultOperation, defaultOperations); err != nil {
+		return err
+	}
+	if err := validateOption("test-option", n.TestOption, []string{"test-then-set", "set", "test-only"}); err != nil {
+		return err
+	}
+	return validateOption("error-option", n.ErrorOption, []string{"stop-on-error", "continue-on-error", "rollback-on-error"})
+}
+
+var defaultOperations = []string{"merge", "replace", "none"}
+
+// validateOption checks that an optional enumerated parameter, if present, has one of the allowed values
+func validateOption(name string, value *string, allowed []string) error {
+	if value != nil && !StringInSlice(*value, allowed) {
+		return errors.New("netconf: " + name + " must be one of " + strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+func validateNMDA(n *Netconf) error {
+	if n.Datastore == nil {
+		return errors.New("netconf: " + *n.Operation + " requires a datastore")
+	}
+	if n.WithOrigin != nil && *n.WithOrigin && datastoreIdentity(*n.Datastore) != "operational" {
+		return errors.New("netconf: with-origin is only valid against the operational datastore")
+	}
+	if n.MaxDepth != nil && *n.MaxDepth <= 0 {
+		return errors.New("netconf: max-depth must be greater than zero")
+	}
+	return validateOption("default-operation", n.DefaultOperation, defaultOperations)
+}
+
+// datastoreIdentity returns the name of a datastore without the ds or ietf-datastores prefix of the identities defined
+// in ietf-datastores
+func datastoreIdentity(datastore string) string {
+	for _, prefix := range []string{"ds:", "ietf-datastores:"} {
+		if strings.HasPrefix(datastore, prefix) {
+			return strings.TrimPrefix(datastore, prefix)
+		}
+	}
+	return datastore
+}
+
+func validateCommit(n *Netconf) error {
+	confirmed := n.Confirmed != nil && *n.Confirmed
+	if !confirmed && (n.ConfirmTimeout != nil || n.Persist != nil) {
+		return errors.New("netconf: confirm-timeout and persist are only valid on a confirmed commit")
+	}
+	if n.ConfirmTimeout != nil && *n.ConfirmTimeout <= 0 {
+		return errors.New("netconf: confirm-timeout must be greater than zero")
+	}
+	return nil
+}
+
+func validateRate(ts *TestSuite) error {
+	if ts.Rate == nil {
+		return nil
+	}
+	// the targets of rate stages are defined in the stages
+	if len(ts.Stages) > 0 {
+		if ts.Rate.Target != 0 {
+			return errors.New("rate: target cannot be used with stages, define the rate in each stage")
+		}
+	} else if ts.Rate.Target <= 0 {
+		return errors.New("rate: target must be greater than zero")
+	}
+	if ts.Rate.Unit != "" && ts.Rate.Unit != RateUnitIteration && ts.Rate.Unit != RateUnitRPC {
+		return errors.New("rate: unit must be iteration or rpc")
+	}
+	if ts.Rate.MaxWorkers < 0 {
+		return errors.New("rate: maxworkers cannot be negative")
+	}
+	if ts.Pacing != 0 {
+		return errors.New("rate: pacing cannot be used with a rate, arrivals are paced by the rate")
+	}
+	if ts.Iterations <= 0 && ts.Duration <= 0 && len(ts.Stages) == 0 {
+		return errors.New("rate: iterations or duration must be defined")
+	}
+	return nil
+}
+
+func validateStages(ts *TestSuite) error {
+	if len(ts.Stages) == 0 {
+		return nil
+	}
+	if ts.Duration != 0 {
+		return errors.New("stages: duration cannot be used with stages, the run lasts for the duration of the stages")
+	}
+	if ts.Iterations != 0 {
+		return errors.New("stages: iterations cannot be used with stages, the run lasts for the duration of the stages")
+	}
+	rate := ts.IsRateStages()
+	if rate && ts.Pacing != 0 {
+		return errors.New("stages: pacing cannot be used with rate stages, arrivals are paced by the rate")
+	}
+	for _, stage := range ts.Stages {
+		if stage.Duration <= 0 {
+			return errors.New("stages: duration must be greater than zero")
+		}
+		if stage.Clients < 0 || stage.Rate < 0 {
+			return errors.New("stages: clients and rate cannot be negative")
+		}
+		if (rate && stage.Clients != 0) || (!rate && stage.Rate != 0) {
+			return errors.New("stages: all stages must define either clients or rate")
+		}
 	}
 	return nil
 }
@@ -315,11 +977,32 @@ func validateSSHConfig(ts *TestSuite) ([]string, error) {
 		if ts.Configs[idx].Hostname == "" {
 			return nil, errors.New("ssh config: hostname cannot be empty")
 		}
-		if ts.Configs[idx].Username == "" {
-			return nil, errors.New("ssh config: username cannot be empty")
+		if ts.Configs[idx].ConnectTimeout < 0 {
+			return nil, errors.New("config: connecttimeout cannot be negative")
 		}
-		if ts.Configs[idx].Password == "" {
-			return nil, errors.New("ssh config: password cannot be empty")
+		switch ts.Configs[idx].Transport {
+		case "", TransportSSH:
+			if ts.Configs[idx].Username == "" {
+				return nil, errors.New("ssh config: username cannot be empty")
+			}
+			if ts.Configs[idx].Password == "" && ts.Configs[idx].PrivateKey == "" && ts.Configs[idx].Agent == "" && len(ts.Configs[idx].KeyboardInteractive) == 0 {
+				return nil, errors.New("ssh config: password, privatekey, agent or keyboardinteractive must be defined")
+			}
+			if ts.Configs[idx].Passphrase != "" && ts.Configs[idx].PrivateKey == "" {
+				return nil, errors.New("ssh config: passphrase requires a privatekey")
+			}
+			if ts.Configs[idx].Insecure && (ts.Configs[idx].KnownHosts != "" || ts.Configs[idx].Fingerprint != "") {
+				return nil, errors.New("ssh config: insecure cannot be used with knownhosts or fingerprint")
+			}
+			if ts.Configs[idx].KnownHosts != "" && ts.Configs[idx].Fingerprint != "" {
+				return nil, errors.New("ssh config: only one of knownhosts or fingerprint can be defined")
+			}
+		case TransportTLS:
+			if ts.Configs[idx].Certificate == "" || ts.Configs[idx].Key == "" {
+				return nil, errors.New("tls config: certificate and key cannot be empty")
+			}
+		default:
+			return nil, errors.New("config: transport must be ssh or tls")
 		}
 		hosts = append(hosts, ts.Configs[idx].Hostname)
 	}
@@ -1,12 +1,17 @@
 package suite_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/damianoneill/nc-hammer/cmd"
 	"github.com/damianoneill/nc-hammer/suite"
 	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
 )
 
 // func init() {
@@ -79,7 +84,9 @@ func TestNetconf_ToXMLString(t *testing.T) {
 		{"valid get-config candidate source", fields{"hostname", nil, nil, cmd.StringAddr("get-config"), &candidate, nil, nil, nil}, "<get-config><source><candidate/></source></get-config>", false},
 		{"valid get-config filter", fields{"hostname", nil, nil, cmd.StringAddr("get-config"), nil, nil, &filter, nil}, "<get-config><source><running/></source><filter type=\"type\"><select/></filter></get-config>", false},
 		{"valid get-config filter with ns", fields{"hostname", nil, nil, cmd.StringAddr("get-config"), nil, nil, &filterWithNs, nil}, "<get-config><source><running/></source><filter type=\"type\"><top xmlns=\"urn:ietf:params:xml:ns:netconf:base:1.0\"><select/></top></filter></get-config>", false},
-		{"not supported kill-session", fields{"hostname", nil, nil, cmd.StringAddr("kill-session"), nil, nil, nil, nil}, "", true},
+		{"kill-session without session-id", fields{"hostname", nil, nil, cmd.StringAddr("kill-session"), nil, nil, nil, nil}, "", true},
+		{"not supported operation", fields{"hostname", nil, nil, cmd.StringAddr("not-an-operation"), nil, nil, nil, nil}, "", true},
+		{"invalid edit-config", fields{"hostname", nil, nil, cmd.StringAddr("edit-config"), nil, nil, nil, cmd.StringAddr("-- config here... --></top>")}, "", true},
 		{"valid get", fields{"hostname", nil, nil, cmd.StringAddr("get"), nil, nil, nil, nil}, "<get/>", false},
 		{"valid edit-config", fields{"hostname1", nil, nil, cmd.StringAddr("edit-config"), nil, nil, nil, nil}, "<edit-config><target><running/></target><config/></edit-config>", false},
 		{"valid edit-config2", fields{"hostname2", nil, nil, cmd.StringAddr("edit-config"), nil, &candidate, nil, &editOperation}, "<edit-config><target><candidate/></target><config><top xmlns=\"http://example.com/schema/1.2/config\"><interface><name>Ethernet0/0</name><mtu>1500</mtu></interface></top></config></edit-config>", false},
@@ -111,6 +118,100 @@ func TestNetconf_ToXMLString(t *testing.T) {
 	}
 }
 
+func TestNetconf_ToXMLStringOperations(t *testing.T) {
+	confirmed := true
+	timeout := 120
+	persist := "nc-hammer"
+	sessionID := 42
+	zero := 0
+	negative := -1
+	nmda := "urn:ietf:params:xml:ns:yang:ietf-netconf-nmda"
+	datastores := "urn:ietf:params:xml:ns:yang:ietf-datastores"
+	config := "<users/>"
+	tests := []struct {
+		name    string
+		netconf suite.Netconf
+		want    string
+		wantErr bool
+	}{
+		{"lock default target", suite.Netconf{Operation: cmd.StringAddr("lock")}, "<lock><target><running/></target></lock>", false},
+		{"lock candidate", suite.Netconf{Operation: cmd.StringAddr("lock"), Target: cmd.StringAddr("candidate")}, "<lock><target><candidate/></target></lock>", false},
+		{"unlock candidate", suite.Netconf{Operation: cmd.StringAddr("unlock"), Target: cmd.StringAddr("candidate")}, "<unlock><target><candidate/></target></unlock>", false},
+		{"validate default source", suite.Netconf{Operation: cmd.StringAddr("validate")}, "<validate><source><candidate/></source></validate>", false},
+		{"validate running", suite.Netconf{Operation: cmd.StringAddr("validate"), Source: cmd.StringAddr("running")}, "<validate><source><running/></source></validate>", false},
+		{"commit", suite.Netconf{Operation: cmd.StringAddr("commit")}, "<commit/>", false},
+		{"confirmed commit", suite.Netconf{Operation: cmd.StringAddr("commit"), Confirmed: &confirmed, ConfirmTimeout: &timeout, Persist: &persist}, "<commit><confirmed/><confirm-timeout>120</confirm-timeout><persist>nc-hammer</persist></commit>", false},
+		{"confirming commit", suite.Netconf{Operation: cmd.StringAddr("commit"), PersistID: &persist}, "<commit><persist-id>nc-hammer</persist-id></commit>", false},
+		{"commit with timeout but not confirmed", suite.Netconf{Operation: cmd.StringAddr("commit"), ConfirmTimeout: &timeout}, "", true},
+		{"cancel-commit", suite.Netconf{Operation: cmd.StringAddr("cancel-commit")}, "<cancel-commit/>", false},
+		{"cancel-commit persist-id", suite.Netconf{Operation: cmd.StringAddr("cancel-commit"), PersistID: &persist}, "<cancel-commit><persist-id>nc-hammer</persist-id></cancel-commit>", false},
+		{"discard-changes", suite.Netconf{Operation: cmd.StringAddr("discard-changes")}, "<discard-changes/>", false},
+		{"copy-config datastores", suite.Netconf{Operation: cmd.StringAddr("copy-config"), Source: cmd.StringAddr("running"), Target: cmd.StringAddr("startup")}, "<copy-config><target><startup/></target><source><running/></source></copy-config>", false},
+		{"copy-config to url", suite.Netconf{Operation: cmd.StringAddr("copy-config"), Source: cmd.StringAddr("running"), Target: cmd.StringAddr("ftp://backup.example.com/running.xml")}, "<copy-config><target><url>ftp://backup.example.com/running.xml</url></target><source><running/></source></copy-config>", false},
+		{"copy-config inline config", suite.Netconf{Operation: cmd.StringAddr("copy-config"), Target: cmd.StringAddr("candidate"), Config: &config}, "<copy-config><target><candidate/></target><source><config><users/></config></source></copy-config>", false},
+		{"copy-config without source", suite.Netconf{Operation: cmd.StringAddr("copy-config"), Target: cmd.StringAddr("candidate")}, "", true},
+		{"delete-config", suite.Netconf{Operation: cmd.StringAddr("delete-config"), Target: cmd.StringAddr("startup")}, "<delete-config><target><startup/></target></delete-config>", false},
+		{"delete-config running", suite.Netconf{Operation: cmd.StringAddr("delete-config"), Target: cmd.StringAddr("running")}, "", true},
+		{"kill-session", suite.Netconf{Operation: cmd.StringAddr("kill-session"), SessionID: &sessionID}, "<kill-session><session-id>42</session-id></kill-session>", false},
+		{"kill-session zero session-id", suite.Netconf{Operation: cmd.StringAddr("kill-session"), SessionID: &zero}, "", true},
+		{"kill-session unresolved session-client", suite.Netconf{Operation: cmd.StringAddr("kill-session"), SessionClient: &zero}, "", true},
+		{"kill-session negative session-client", suite.Netconf{Operation: cmd.StringAddr("kill-session"), SessionClient: &negative}, "", true},
+		{"kill-session session-id and session-client", suite.Netconf{Operation: cmd.StringAddr("kill-session"), SessionID: &sessionID, SessionClient: &zero}, "", true},
+		{"close-session", suite.Netconf{Operation: cmd.StringAddr("close-session")}, "<close-session/>", false},
+		{"get-data operational", suite.Netconf{Operation: cmd.StringAddr("get-data"), Datastore: cmd.StringAddr("operational"), WithOrigin: &confirmed, MaxDepth: &timeout, ConfigFilter: &confirmed}, "<get-data xmlns=\"" + nmda + "\" xmlns:ds=\"" + datastores + "\"><datastore>ds:operational</datastore><config-filter>true</config-filter><max-depth>120</max-depth><with-origin/></get-data>", false},
+		{"get-data subtree-filter", suite.Netconf{Operation: cmd.StringAddr("get-data"), Datastore: cmd.StringAddr("intended"), Filter: &suite.Filter{Type: "subtree", Select: "<users/>"}}, "<get-data xmlns=\"" + nmda + "\" xmlns:ds=\"" + datastores + "\"><datastore>ds:intended</datastore><subtree-filter><users/></subtree-filter></get-data>", false},
+		{"get-data xpath-filter", suite.Netconf{Operation: cmd.StringAddr("get-data"), Datastore: cmd.StringAddr("ex:custom"), Filter: &suite.Filter{Type: "xpath", Select: "/users"}}, "<get-data xmlns=\"" + nmda + "\" xmlns:ds=\"" + datastores + "\"><datastore>ex:custom</datastore><xpath-filter>/users</xpath-filter></get-data>", false},
+		{"get-data without datastore", suite.Netconf{Operation: cmd.StringAddr("get-data")}, "", true},
+		{"get-data with-origin on ds:operational", suite.Netconf{Operation: cmd.StringAddr("get-data"), Datastore: cmd.StringAddr("ds:operational"), WithOrigin: &confirmed}, "<get-data xmlns=\"" + nmda + "\" xmlns:ds=\"" + datastores + "\"><datastore>ds:operational</datastore><with-origin/></get-data>", false},
+		{"get-data with-origin on ietf-datastores:operational", suite.Netconf{Operation: cmd.StringAddr("get-data"), Datastore: cmd.StringAddr("ietf-datastores:operational"), WithOrigin: &confirmed}, "<get-data xmlns=\"" + nmda + "\" xmlns:ds=\"" + datastores + "\"><datastore>ietf-datastores:operational</datastore><with-origin/></get-data>", false},
+		{"get-data with-origin on ds:running", suite.Netconf{Operation: cmd.StringAddr("get-data"), Datastore: cmd.StringAddr("ds:running"), WithOrigin: &confirmed}, "", true},
+		{"get-data invalid subtree-filter", suite.Netconf{Operation: cmd.StringAddr("get-data"), Datastore: cmd.StringAddr("running"), Filter: &suite.Filter{Type: "subtree", Select: "users"}}, "", true},
+		{"get invalid filter", suite.Netconf{Operation: cmd.StringAddr("get"), Filter: &suite.Filter{Type: "subtree", Select: "users"}}, "", true},
+		{"get-config empty filter", suite.Netconf{Operation: cmd.StringAddr("get-config"), Filter: &suite.Filter{Type: "subtree"}}, "", true},
+		{"establish-subscription invalid filter", suite.Netconf{Operation: cmd.StringAddr("establish-subscription"), Datastore: cmd.StringAddr("operational"), Filter: &suite.Filter{Type: "subtree", Select: "users"}, Period: &timeout}, "", true},
+		{"get-data with-origin on running", suite.Netconf{Operation: cmd.StringAddr("get-data"), Datastore: cmd.StringAddr("running"), WithOrigin: &confirmed}, "", true},
+		{"get with-defaults", suite.Netconf{Operation: cmd.StringAddr("get"), WithDefaults: cmd.StringAddr("report-all-tagged")}, "<get><with-defaults xmlns=\"urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults\">report-all-tagged</with-defaults></get>", false},
+		{"get-config filter with-defaults", suite.Netconf{Operation: cmd.StringAddr("get-config"), Filter: &suite.Filter{Type: "subtree", Select: "<users/>"}, WithDefaults: cmd.StringAddr("trim")}, "<get-config><source><running/></source><filter type=\"subtree\"><users/></filter><with-defaults xmlns=\"urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults\">trim</with-defaults></get-config>", false},
+		{"get-data with-defaults", suite.Netconf{Operation: cmd.StringAddr("get-data"), Datastore: cmd.StringAddr("operational"), WithOrigin: &confirmed, WithDefaults: cmd.StringAddr("report-all")}, "<get-data xmlns=\"" + nmda + "\" xmlns:ds=\"" + datastores + "\"><datastore>ds:operational</datastore><with-origin/><with-defaults>report-all</with-defaults></get-data>", false},
+		{"invalid with-defaults mode", suite.Netconf{Operation: cmd.StringAddr("get"), WithDefaults: cmd.StringAddr("all")}, "", true},
+		{"with-defaults on edit-config", suite.Netconf{Operation: cmd.StringAddr("edit-config"), WithDefaults: cmd.StringAddr("trim")}, "", true},
+		{"create-subscription", suite.Netconf{Operation: cmd.StringAddr("create-subscription")}, "<create-subscription xmlns=\"urn:ietf:params:xml:ns:netconf:notification:1.0\"/>", false},
+		{"create-subscription replay", suite.Netconf{Operation: cmd.StringAddr("create-subscription"), Stream: cmd.StringAddr("syslog"), Filter: &suite.Filter{Type: "subtree", Select: "<event/>"}, StartTime: cmd.StringAddr("2018-07-18T19:56:01Z"), StopTime: cmd.StringAddr("2018-07-18T20:56:01Z"), Listen: &timeout}, "<create-subscription xmlns=\"urn:ietf:params:xml:ns:netconf:notification:1.0\"><stream>syslog</stream><filter type=\"subtree\"><event/></filter><startTime>2018-07-18T19:56:01Z</startTime><stopTime>2018-07-18T20:56:01Z</stopTime></create-subscription>", false},
+		{"establish-subscription stream", suite.Netconf{Operation: cmd.StringAddr("establish-subscription"), Filter: &suite.Filter{Type: "xpath", Select: "/event"}}, "<establish-subscription xmlns=\"urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications\"><stream>NETCONF</stream><stream-xpath-filter>/event</stream-xpath-filter></establish-subscription>", false},
+		{"establish-subscription periodic", suite.Netconf{Operation: cmd.StringAddr("establish-subscription"), Datastore: cmd.StringAddr("operational"), Filter: &suite.Filter{Type: "subtree", Select: "<users/>"}, Period: &timeout}, "<establish-subscription xmlns=\"urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications\" xmlns:yp=\"urn:ietf:params:xml:ns:yang:ietf-yang-push\" xmlns:ds=\"" + datastores + "\"><yp:datastore>ds:operational</yp:datastore><yp:datastore-subtree-filter><users/></yp:datastore-subtree-filter><yp:periodic><yp:period>120</yp:period></yp:periodic></establish-subscription>", false},
+		{"establish-subscription on-change", suite.Netconf{Operation: cmd.StringAddr("establish-subscription"), Datastore: cmd.StringAddr("running"), OnChange: &confirmed}, "<establish-subscription xmlns=\"urn:ietf:params:xml:ns:yang:ietf-subscribed-notifications\" xmlns:yp=\"urn:ietf:params:xml:ns:yang:ietf-yang-push\" xmlns:ds=\"" + datastores + "\"><yp:datastore>ds:running</yp:datastore><yp:on-change/></establish-subscription>", false},
+		{"establish-subscription datastore without trigger", suite.Netconf{Operation: cmd.StringAddr("establish-subscription"), Datastore: cmd.StringAddr("running")}, "", true},
+		{"establish-subscription period without datastore", suite.Netconf{Operation: cmd.StringAddr("establish-subscription"), Period: &timeout}, "", true},
+		{"listen on get", suite.Netconf{Operation: cmd.StringAddr("get"), Listen: &timeout}, "", true},
+		{"edit-config options", suite.Netconf{Operation: cmd.StringAddr("edit-config"), Target: cmd.StringAddr("candidate"), DefaultOperation: cmd.StringAddr("replace"), TestOption: cmd.StringAddr("test-then-set"), ErrorOption: cmd.StringAddr("rollback-on-error"), Config: &config}, "<edit-config><target><candidate/></target><default-operation>replace</default-operation><test-option>test-then-set</test-option><error-option>rollback-on-error</error-option><config><users/></config></edit-config>", false},
+		{"edit-config url", suite.Netconf{Operation: cmd.StringAddr("edit-config"), DefaultOperation: cmd.StringAddr("none"), URL: cmd.StringAddr("file:///config.xml")}, "<edit-config><target><running/></target><default-operation>none</default-operation><url>file:///config.xml</url></edit-config>", false},
+		{"edit-config url and config", suite.Netconf{Operation: cmd.StringAddr("edit-config"), URL: cmd.StringAddr("file:///config.xml"), Config: &config}, "", true},
+		{"edit-config invalid default-operation", suite.Netconf{Operation: cmd.StringAddr("edit-config"), DefaultOperation: cmd.StringAddr("delete")}, "", true},
+		{"edit-config invalid test-option", suite.Netconf{Operation: cmd.StringAddr("edit-config"), TestOption: cmd.StringAddr("test")}, "", true},
+		{"edit-config invalid error-option", suite.Netconf{Operation: cmd.StringAddr("edit-config"), ErrorOption: cmd.StringAddr("ignore-error")}, "", true},
+		{"edit-data default-operation", suite.Netconf{Operation: cmd.StringAddr("edit-data"), Datastore: cmd.StringAddr("running"), DefaultOperation: cmd.StringAddr("merge"), Config: &config}, "<edit-data xmlns=\"" + nmda + "\" xmlns:ds=\"" + datastores + "\"><datastore>ds:running</datastore><default-operation>merge</default-operation><config><users/></config></edit-data>", false},
+		{"edit-data", suite.Netconf{Operation: cmd.StringAddr("edit-data"), Datastore: cmd.StringAddr("running"), Config: &config}, "<edit-data xmlns=\"" + nmda + "\" xmlns:ds=\"" + datastores + "\"><datastore>ds:running</datastore><config><users/></config></edit-data>", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.netconf.ToXMLString()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Netconf.ToXMLString() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNetconf_SubscribedStream(t *testing.T) {
+	assert.Equal(t, suite.DefaultStream, (&suite.Netconf{Operation: cmd.StringAddr("create-subscription")}).SubscribedStream())
+	assert.Equal(t, "syslog", (&suite.Netconf{Operation: cmd.StringAddr("create-subscription"), Stream: cmd.StringAddr("syslog")}).SubscribedStream())
+	assert.Equal(t, suite.YangPushStream, (&suite.Netconf{Operation: cmd.StringAddr("establish-subscription"), Datastore: cmd.StringAddr("running")}).SubscribedStream())
+	assert.True(t, (&suite.Netconf{Operation: cmd.StringAddr("establish-subscription")}).IsSubscription())
+	assert.False(t, (&suite.Netconf{Operation: cmd.StringAddr("get")}).IsSubscription())
+}
+
 func TestNewTestSuite(t *testing.T) {
 	emptyTs := suite.TestSuite{}
 	emptyTs.File = "testdata/emptytestsuite.yml"
@@ -126,6 +227,7 @@ func TestNewTestSuite(t *testing.T) {
 		// TODO: Add test cases.
 		{"file not present", args{"doesnt-exist.txt"}, nil, true},
 		{"file present, no content", args{"testdata/emptytestsuite.yml"}, nil, true},
+		{"confirm-timeout without confirmed commit", args{"testdata/candidate-invalid.yml"}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -141,6 +243,18 @@ func TestNewTestSuite(t *testing.T) {
 	}
 }
 
+func TestNewTestSuite_Candidate(t *testing.T) {
+	ts, err := suite.NewTestSuite("testdata/candidate.yml")
+	if err != nil {
+		t.Fatalf("Problem loading testdata/candidate.yml: %v", err)
+	}
+	actions := ts.Blocks[0].Actions
+	assert.Equal(t, "lock", *actions[0].Netconf.Operation)
+	assert.True(t, *actions[3].Netconf.Confirmed)
+	assert.Equal(t, 120, *actions[3].Netconf.ConfirmTimeout)
+	assert.Equal(t, "nc-hammer", *actions[4].Netconf.PersistID)
+}
+
 func TestTestSuite_GetConfig(t *testing.T) {
 	got, err := suite.NewTestSuite("testdata/testsuite.yml")
 	if err != nil {
@@ -197,6 +311,171 @@ func Test_IsReuseConnection(t *testing.T) {
 	}
 }
 
+func TestConfigs_Transport(t *testing.T) {
+	got, err := suite.NewTestSuite("testdata/tls.yml")
+	if err != nil {
+		t.Fatalf("Problem loading testdata/tls.yml: %v", err)
+	}
+	assert.Equal(t, suite.TransportSSH, got.Configs.Transport("10.0.0.1"))
+	assert.Equal(t, suite.TransportTLS, got.Configs.Transport("10.0.0.2"))
+	assert.Equal(t, "", got.GetConfig("10.0.0.2").Username)
+}
+
+func TestValidateTransport(t *testing.T) {
+	tests := []struct {
+		name   string
+		config suite.Sshconfig
+		err    string
+	}{
+		{"ssh requires an authentication method", suite.Sshconfig{Hostname: "10.0.0.1", Username: "uname"}, "ssh config: password, privatekey, agent or keyboardinteractive must be defined"},
+		{"ssh passphrase requires privatekey", suite.Sshconfig{Hostname: "10.0.0.1", Username: "uname", Agent: "$SSH_AUTH_SOCK", Passphrase: "secret"}, "ssh config: passphrase requires a privatekey"},
+		{"insecure with fingerprint", suite.Sshconfig{Hostname: "10.0.0.1", Username: "uname", Password: "pass", Insecure: true, Fingerprint: "SHA256:abc"}, "ssh config: insecure cannot be used with knownhosts or fingerprint"},
+		{"knownhosts and fingerprint", suite.Sshconfig{Hostname: "10.0.0.1", Username: "uname", Password: "pass", KnownHosts: "known_hosts", Fingerprint: "SHA256:abc"}, "ssh config: only one of knownhosts or fingerprint can be defined"},
+		{"tls requires certificate", suite.Sshconfig{Hostname: "10.0.0.1", Transport: "tls", Key: "key.pem"}, "tls config: certificate and key cannot be empty"},
+		{"negative connecttimeout", suite.Sshconfig{Hostname: "10.0.0.1", Username: "uname", Password: "pass", ConnectTimeout: -1}, "config: connecttimeout cannot be negative"},
+		{"unknown transport", suite.Sshconfig{Hostname: "10.0.0.1", Transport: "telnet"}, "config: transport must be ssh or tls"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bytes, _ := yaml.Marshal(suite.TestSuite{Configs: suite.Configs{tt.config}})
+			file := filepath.Join(os.TempDir(), "nc-hammer-transport.yml")
+			ioutil.WriteFile(file, bytes, 0644)
+			defer os.Remove(file)
+			_, err := suite.NewTestSuite(file)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestValidateRate(t *testing.T) {
+	config := suite.Sshconfig{Hostname: "10.0.0.1", Username: "uname", Password: "pass"}
+	tests := []struct {
+		name string
+		ts   suite.TestSuite
+		err  string
+	}{
+		{"target required", suite.TestSuite{Iterations: 1, Rate: &suite.Rate{}}, "rate: target must be greater than zero"},
+		{"unknown unit", suite.TestSuite{Iterations: 1, Rate: &suite.Rate{Target: 10, Unit: "block"}}, "rate: unit must be iteration or rpc"},
+		{"negative maxworkers", suite.TestSuite{Iterations: 1, Rate: &suite.Rate{Target: 10, MaxWorkers: -1}}, "rate: maxworkers cannot be negative"},
+		{"unlimited", suite.TestSuite{Rate: &suite.Rate{Target: 10}}, "rate: iterations or duration must be defined"},
+		{"negative duration", suite.TestSuite{Duration: -1}, "Testsuite duration cannot be negative"},
+		{"valid", suite.TestSuite{Duration: 60, Rate: &suite.Rate{Target: 10, Unit: "rpc"}}, ""},
+		{"rate target with stages", suite.TestSuite{Rate: &suite.Rate{Target: 10}, Stages: []suite.Stage{{Rate: 10, Duration: 10}}}, "rate: target cannot be used with stages, define the rate in each stage"},
+		{"rate stages", suite.TestSuite{Rate: &suite.Rate{Unit: "rpc"}, Stages: []suite.Stage{{Rate: 10, Duration: 10}}}, ""},
+		{"stages with duration", suite.TestSuite{Duration: 60, Stages: []suite.Stage{{Clients: 10, Duration: 10}}}, "stages: duration cannot be used with stages, the run lasts for the duration of the stages"},
+		{"stages with iterations", suite.TestSuite{Iterations: 100, Stages: []suite.Stage{{Clients: 10, Duration: 10}}}, "stages: iterations cannot be used with stages, the run lasts for the duration of the stages"},
+		{"stage without duration", suite.TestSuite{Stages: []suite.Stage{{Clients: 10}}}, "stages: duration must be greater than zero"},
+		{"negative stage clients", suite.TestSuite{Stages: []suite.Stage{{Clients: -1, Duration: 10}}}, "stages: clients and rate cannot be negative"},
+		{"mixed stages", suite.TestSuite{Stages: []suite.Stage{{Clients: 10, Duration: 10}, {Rate: 10, Duration: 10}}}, "stages: all stages must define either clients or rate"},
+		{"negative pacing", suite.TestSuite{Iterations: 1, Pacing: -1}, "Testsuite pacing cannot be negative"},
+		{"pacing with rate", suite.TestSuite{Iterations: 1, Pacing: 100, Rate: &suite.Rate{Target: 10}}, "rate: pacing cannot be used with a rate, arrivals are paced by the rate"},
+		{"pacing with rate stages", suite.TestSuite{Pacing: 100, Stages: []suite.Stage{{Rate: 10, Duration: 10}}}, "stages: pacing cannot be used with rate stages, arrivals are paced by the rate"},
+		{"paced client stages", suite.TestSuite{Pacing: 100, Stages: []suite.Stage{{Clients: 10, Duration: 10}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.ts.Configs = suite.Configs{config}
+			bytes, _ := yaml.Marshal(tt.ts)
+			file := filepath.Join(os.TempDir(), "nc-hammer-rate.yml")
+			ioutil.WriteFile(file, bytes, 0644)
+			defer os.Remove(file)
+			_, err := suite.NewTestSuite(file)
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+	assert.Equal(t, suite.RateUnitIteration, (&suite.Rate{}).GetUnit())
+	assert.Equal(t, suite.DefaultMaxWorkers, (&suite.Rate{}).GetMaxWorkers())
+	assert.Equal(t, suite.DefaultConnectTimeout*time.Second, (&suite.Sshconfig{}).GetConnectTimeout())
+	assert.Equal(t, 5*time.Second, (&suite.Sshconfig{ConnectTimeout: 5}).GetConnectTimeout())
+}
+
+func TestValidateAssert(t *testing.T) {
+	config := suite.Sshconfig{Hostname: "10.0.0.1", Username: "uname", Password: "pass"}
+	count := -1
+	exists := true
+	tests := []struct {
+		name   string
+		assert suite.Assert
+		err    string
+	}{
+		{"valid", suite.Assert{Path: "data/if:interfaces", Namespaces: map[string]string{"if": "urn:ietf:params:xml:ns:yang:ietf-interfaces"}, Compare: cmd.StringAddr(">= 1")}, ""},
+		{"path required", suite.Assert{}, "assert: path  is not a valid path"},
+		{"invalid path", suite.Assert{Path: "data[name"}, "assert: path data[name is not a valid path"},
+		{"one check", suite.Assert{Path: "data", Exists: &exists, Equals: cmd.StringAddr("x")}, "assert: only one of exists, count, equals or compare can be defined"},
+		{"negative count", suite.Assert{Path: "data", Count: &count}, "assert: count cannot be negative"},
+		{"invalid compare", suite.Assert{Path: "data", Compare: cmd.StringAddr("~ 1")}, "assert: compare must be an operator (!=, <=, >=, =, <, >) followed by a number"},
+		{"compare without a number", suite.Assert{Path: "data", Compare: cmd.StringAddr(">= x")}, "assert: compare must be an operator (!=, <=, >=, =, <, >) followed by a number"},
+		{"empty namespace", suite.Assert{Path: "data", Namespaces: map[string]string{"if": ""}}, "assert: namespaces must map a prefix to a namespace URI"},
+		{"two prefixes for a namespace", suite.Assert{Path: "data", Namespaces: map[string]string{"if": "urn:ietf:params:xml:ns:yang:ietf-interfaces", "ifs": "urn:ietf:params:xml:ns:yang:ietf-interfaces"}}, "assert: namespaces cannot map two prefixes to the same namespace URI"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := suite.TestSuite{Iterations: 1, Configs: suite.Configs{config}, Blocks: []suite.Block{{Type: "sequential", Actions: []suite.Action{
+				{Netconf: &suite.Netconf{Hostname: "10.0.0.1", Operation: cmd.StringAddr("get"), Assert: []suite.Assert{tt.assert}}},
+			}}}}
+			bytes, _ := yaml.Marshal(ts)
+			file := filepath.Join(os.TempDir(), "nc-hammer-assert.yml")
+			ioutil.WriteFile(file, bytes, 0644)
+			defer os.Remove(file)
+			_, err := suite.NewTestSuite(file)
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+
+	operator, value, err := (&suite.Assert{Compare: cmd.StringAddr(" <=9000.5 ")}).Comparison()
+	assert.Nil(t, err)
+	assert.Equal(t, "<=", operator)
+	assert.Equal(t, 9000.5, value)
+}
+
+func TestValidateExpected(t *testing.T) {
+	config := suite.Sshconfig{Hostname: "10.0.0.1", Username: "uname", Password: "pass"}
+	tests := []struct {
+		name     string
+		expected string
+		err      string
+	}{
+		{"valid", "(<[^>]+>)", ""},
+		{"invalid", "(<[^>]+>", "netconf: expected is not a valid regular expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := suite.TestSuite{Iterations: 1, Configs: suite.Configs{config}, Blocks: []suite.Block{{Type: "sequential", Actions: []suite.Action{
+				{Netconf: &suite.Netconf{Hostname: "10.0.0.1", Operation: cmd.StringAddr("get"), Expected: cmd.StringAddr(tt.expected)}},
+			}}}}
+			bytes, _ := yaml.Marshal(ts)
+			file := filepath.Join(os.TempDir(), "nc-hammer-expected.yml")
+			ioutil.WriteFile(file, bytes, 0644)
+			defer os.Remove(file)
+			_, err := suite.NewTestSuite(file)
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTestSuite_StageLabel(t *testing.T) {
+	ts := suite.TestSuite{Stages: []suite.Stage{{Name: "warm-up"}, {}}}
+	assert.Equal(t, "warm-up", ts.StageLabel(1))
+	assert.Equal(t, "2", ts.StageLabel(2))
+	assert.Equal(t, "", ts.StageLabel(0))
+	assert.Equal(t, "", ts.StageLabel(3))
+	assert.False(t, ts.IsRateStages())
+	ts.Stages[1].Rate = 10
+	assert.True(t, ts.IsRateStages())
+}
+
 func TestInlineXML(t *testing.T) {
 
 	ts, err := suite.NewTestSuite("testdata/inline.yml")